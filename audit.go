@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// auditDir — каталог на control plane с конфигурацией webhook аудита, монтируется в под API server
+const auditDir = "/var/lib/audit"
+
+// auditLogDir — каталог журнала аудита, который Talos монтирует в под API server
+const auditLogDir = "/var/log/audit/kube/"
+
+// AuditConfig — политика аудита API server, журнал на ноде и отправка событий во внешний сборщик
+type AuditConfig struct {
+	Preset     string        `yaml:"preset,omitempty"`
+	PolicyFile string        `yaml:"policyFile,omitempty"`
+	LogPath    string        `yaml:"logPath,omitempty"`
+	MaxAge     int           `yaml:"maxAge,omitempty"`
+	MaxBackup  int           `yaml:"maxBackup,omitempty"`
+	MaxSize    int           `yaml:"maxSize,omitempty"`
+	Webhook    *AuditWebhook `yaml:"webhook,omitempty"`
+}
+
+// AuditWebhook — внешний сборщик событий аудита (webhook backend API server)
+type AuditWebhook struct {
+	URL    string `yaml:"url"`
+	CAFile string `yaml:"caFile,omitempty"`
+	Mode   string `yaml:"mode,omitempty"`
+}
+
+// auditRule — правило политики аудита
+func auditRule(level string, fields map[string]interface{}) map[string]interface{} {
+	rule := map[string]interface{}{"level": level}
+	for k, v := range fields {
+		rule[k] = v
+	}
+	return rule
+}
+
+var (
+	auditSensitive = map[string]interface{}{"resources": []map[string]interface{}{
+		{"group": "", "resources": []string{"secrets", "configmaps", "serviceaccounts/token"}},
+		{"group": "authentication.k8s.io", "resources": []string{"tokenreviews"}},
+	}}
+	auditNoise = []map[string]interface{}{
+		auditRule("None", map[string]interface{}{"nonResourceURLs": []string{"/healthz*", "/livez*", "/readyz*", "/metrics", "/version"}}),
+		auditRule("None", map[string]interface{}{"resources": []map[string]interface{}{{"group": "", "resources": []string{"events"}}}}),
+		auditRule("None", map[string]interface{}{"users": []string{"system:kube-proxy"}, "verbs": []string{"watch"}}),
+		auditRule("None", map[string]interface{}{"verbs": []string{"get", "list", "watch"}, "resources": []map[string]interface{}{
+			{"group": "coordination.k8s.io", "resources": []string{"leases"}},
+		}}),
+	}
+)
+
+// auditPresets — готовые политики аудита: правила Policy без apiVersion/kind
+var auditPresets = map[string][]map[string]interface{}{
+	// metadata: кто, что и когда — без тел запросов
+	"metadata": {
+		auditRule("Metadata", nil),
+	},
+	// baseline: без шумных запросов, секреты только на уровне Metadata, изменения с телом запроса
+	"baseline": append(append([]map[string]interface{}{}, auditNoise...),
+		auditRule("Metadata", auditSensitive),
+		auditRule("RequestResponse", map[string]interface{}{"resources": []map[string]interface{}{
+			{"group": "rbac.authorization.k8s.io"},
+		}}),
+		auditRule("Request", map[string]interface{}{"verbs": []string{"create", "update", "patch", "delete", "deletecollection"}}),
+		auditRule("Metadata", nil),
+	),
+	// strict: все запросы с телами запроса и ответа, кроме секретов
+	"strict": append(append([]map[string]interface{}{}, auditNoise[:1]...),
+		auditRule("Metadata", auditSensitive),
+		auditRule("RequestResponse", nil),
+	),
+}
+
+// auditPolicy возвращает политику аудита для cluster.apiServer.auditPolicy
+func (a *AuditConfig) auditPolicy() (map[string]interface{}, error) {
+	if a.PolicyFile != "" {
+		data, err := os.ReadFile(a.PolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("audit.policyFile: %v", err)
+		}
+		var policy map[string]interface{}
+		if err := yaml.Unmarshal(data, &policy); err != nil {
+			return nil, fmt.Errorf("audit.policyFile: %v", err)
+		}
+		if policy["kind"] != "Policy" {
+			return nil, fmt.Errorf("audit.policyFile: expected kind Policy, got %v", policy["kind"])
+		}
+		return policy, nil
+	}
+	preset := a.Preset
+	if preset == "" {
+		preset = "baseline"
+	}
+	return map[string]interface{}{
+		"apiVersion": "audit.k8s.io/v1",
+		"kind":       "Policy",
+		"omitStages": []string{"RequestReceived"},
+		"rules":      auditPresets[preset],
+	}, nil
+}
+
+// webhookKubeconfig формирует kubeconfig, по которому API server отправляет события сборщику
+func (w *AuditWebhook) webhookKubeconfig() (string, error) {
+	cluster := map[string]interface{}{"server": w.URL}
+	if w.CAFile != "" {
+		data, err := os.ReadFile(w.CAFile)
+		if err != nil {
+			return "", fmt.Errorf("audit.webhook.caFile: %v", err)
+		}
+		cluster["certificate-authority-data"] = base64.StdEncoding.EncodeToString(data)
+	}
+	return yamlString(map[string]interface{}{
+		"apiVersion":      "v1",
+		"kind":            "Config",
+		"clusters":        []interface{}{map[string]interface{}{"name": "audit", "cluster": cluster}},
+		"contexts":        []interface{}{map[string]interface{}{"name": "audit", "context": map[string]interface{}{"cluster": "audit", "user": "audit"}}},
+		"users":           []interface{}{map[string]interface{}{"name": "audit", "user": map[string]interface{}{}}},
+		"current-context": "audit",
+	}), nil
+}
+
+// applyAudit добавляет политику аудита, параметры журнала и webhook в cluster.apiServer патча
+func applyAudit(ans Answers, cluster map[string]interface{}) error {
+	a := ans.Audit
+	if a == nil {
+		return nil
+	}
+	policy, err := a.auditPolicy()
+	if err != nil {
+		return err
+	}
+	apiServer := nestedMap(cluster, "apiServer")
+	apiServer["auditPolicy"] = policy
+	args := componentArgs(cluster, "apiServer")
+	if a.LogPath != "" {
+		args["audit-log-path"] = a.LogPath
+	}
+	for arg, value := range map[string]int{"audit-log-maxage": a.MaxAge, "audit-log-maxbackup": a.MaxBackup, "audit-log-maxsize": a.MaxSize} {
+		if value > 0 {
+			args[arg] = strconv.Itoa(value)
+		}
+	}
+	if w := a.Webhook; w != nil {
+		args["audit-webhook-config-file"] = auditDir + "/webhook.yaml"
+		mode := w.Mode
+		if mode == "" {
+			mode = "batch"
+		}
+		args["audit-webhook-mode"] = mode
+		volumes, _ := apiServer["extraVolumes"].([]map[string]interface{})
+		apiServer["extraVolumes"] = append(volumes, map[string]interface{}{
+			"hostPath": auditDir, "mountPath": auditDir, "readonly": true,
+		})
+	}
+	return nil
+}
+
+// applyAuditFiles добавляет kubeconfig webhook аудита в machine.files патча control plane
+func applyAuditFiles(ans Answers, machine map[string]interface{}) error {
+	if ans.Audit == nil || ans.Audit.Webhook == nil {
+		return nil
+	}
+	content, err := ans.Audit.Webhook.webhookKubeconfig()
+	if err != nil {
+		return err
+	}
+	existing, _ := machine["files"].([]map[string]interface{})
+	machine["files"] = append(existing, map[string]interface{}{
+		"path":        auditDir + "/webhook.yaml",
+		"content":     content,
+		"permissions": 0o644,
+		"op":          "create",
+	})
+	return nil
+}
+
+// validateAudit проверяет секцию audit
+func validateAudit(ans Answers) error {
+	a := ans.Audit
+	if a == nil {
+		return nil
+	}
+	if a.Preset != "" && a.PolicyFile != "" {
+		return fmt.Errorf("audit: use either preset or policyFile")
+	}
+	if a.Preset != "" {
+		if _, ok := auditPresets[a.Preset]; !ok {
+			presets := make([]string, 0, len(auditPresets))
+			for name := range auditPresets {
+				presets = append(presets, name)
+			}
+			sort.Strings(presets)
+			return fmt.Errorf("audit: unknown preset %q (expected %s)", a.Preset, strings.Join(presets, ", "))
+		}
+	}
+	if _, err := a.auditPolicy(); err != nil {
+		return err
+	}
+	if a.LogPath != "" && a.LogPath != "-" && !strings.HasPrefix(a.LogPath, auditLogDir) {
+		return fmt.Errorf("audit.logPath must be inside %s (mounted into the API server) or \"-\" for stdout", auditLogDir)
+	}
+	if a.MaxAge < 0 || a.MaxBackup < 0 || a.MaxSize < 0 {
+		return fmt.Errorf("audit: maxAge, maxBackup and maxSize must not be negative")
+	}
+	if w := a.Webhook; w != nil {
+		if !strings.HasPrefix(w.URL, "https://") && !strings.HasPrefix(w.URL, "http://") {
+			return fmt.Errorf("audit.webhook.url must be an http(s):// URL")
+		}
+		if w.Mode != "" && w.Mode != "batch" && w.Mode != "blocking" && w.Mode != "blocking-strict" {
+			return fmt.Errorf("audit.webhook.mode: unknown value %q (expected batch, blocking or blocking-strict)", w.Mode)
+		}
+		if _, err := w.webhookKubeconfig(); err != nil {
+			return err
+		}
+	}
+	if c := ans.ControlPlane; c != nil && c.APIServer != nil {
+		for k := range c.APIServer.ExtraArgs {
+			if strings.HasPrefix(k, "audit-") {
+				return fmt.Errorf("controlPlane.apiServer.extraArgs: %s conflicts with the audit section", k)
+			}
+		}
+	}
+	return nil
+}
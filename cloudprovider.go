@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Версии манифестов по умолчанию закреплены тегами релизов,
+// чтобы ноды, добавленные позже, получали те же манифесты
+const (
+	talosCCMVersion    = "v1.8.0"
+	csrApproverVersion = "v0.9.0"
+)
+
+// Манифесты по умолчанию: Talos CCM и одобрение CSR сертификатов kubelet-serving
+const (
+	talosCCMManifest    = "https://raw.githubusercontent.com/siderolabs/talos-cloud-controller-manager/" + talosCCMVersion + "/docs/deploy/cloud-controller-manager.yml"
+	csrApproverManifest = "https://raw.githubusercontent.com/alex1989hu/kubelet-serving-cert-approver/" + csrApproverVersion + "/deploy/standalone-install.yaml"
+)
+
+// CloudProviderConfig — внешний cloud provider (Talos CCM) и серверные сертификаты kubelet.
+// Манифест — URL или локальный файл; локальные файлы встраиваются в cluster.inlineManifests.
+type CloudProviderConfig struct {
+	Enabled              bool     `yaml:"enabled"`
+	CCMManifests         []string `yaml:"ccmManifests,omitempty"`
+	CSRApproverManifests []string `yaml:"csrApproverManifests,omitempty"`
+}
+
+func (c *CloudProviderConfig) ccmManifests() []string {
+	if len(c.CCMManifests) == 0 {
+		return []string{talosCCMManifest}
+	}
+	return c.CCMManifests
+}
+
+func (c *CloudProviderConfig) csrApproverManifests() []string {
+	if len(c.CSRApproverManifests) == 0 {
+		return []string{csrApproverManifest}
+	}
+	return c.CSRApproverManifests
+}
+
+func cloudProviderEnabled(ans Answers) bool {
+	return ans.CloudProvider != nil && ans.CloudProvider.Enabled
+}
+
+func isManifestURL(manifest string) bool {
+	return strings.HasPrefix(manifest, "https://") || strings.HasPrefix(manifest, "http://")
+}
+
+// inlineManifest читает локальный манифест для cluster.inlineManifests; имя — имя файла без расширения
+func inlineManifest(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return map[string]interface{}{"name": name, "contents": string(data)}, nil
+}
+
+// applyCloudProvider включает cluster.externalCloudProvider, ротацию серверных сертификатов kubelet
+// и добавляет манифесты Talos CCM и approver'а CSR в patch.yaml
+func applyCloudProvider(ans Answers, patch PatchConfig) error {
+	if !cloudProviderEnabled(ans) {
+		return nil
+	}
+	c := ans.CloudProvider
+	var inline []interface{}
+	split := func(manifests []string) ([]string, error) {
+		var urls []string
+		for _, m := range manifests {
+			if isManifestURL(m) {
+				urls = append(urls, m)
+				continue
+			}
+			manifest, err := inlineManifest(m)
+			if err != nil {
+				return nil, fmt.Errorf("cloudProvider: %v", err)
+			}
+			inline = append(inline, manifest)
+		}
+		return urls, nil
+	}
+	ccmURLs, err := split(c.ccmManifests())
+	if err != nil {
+		return err
+	}
+	csrApproverURLs, err := split(c.csrApproverManifests())
+	if err != nil {
+		return err
+	}
+	nestedMap(patch.Machine, "kubelet", "extraArgs")["rotate-server-certificates"] = "true"
+	provider := nestedMap(patch.Cluster, "externalCloudProvider")
+	provider["enabled"] = true
+	if len(ccmURLs) > 0 {
+		provider["manifests"] = ccmURLs
+	}
+	if len(csrApproverURLs) > 0 {
+		extra, _ := patch.Cluster["extraManifests"].([]string)
+		patch.Cluster["extraManifests"] = append(extra, csrApproverURLs...)
+	}
+	if len(inline) > 0 {
+		existing, _ := patch.Cluster["inlineManifests"].([]interface{})
+		patch.Cluster["inlineManifests"] = append(existing, inline...)
+	}
+	return nil
+}
+
+// validateCloudProvider проверяет, что локальные манифесты читаются и имена inline-манифестов не повторяются
+func validateCloudProvider(ans Answers) error {
+	if !cloudProviderEnabled(ans) {
+		return nil
+	}
+	c := ans.CloudProvider
+	names := map[string]bool{}
+	for _, m := range append(c.ccmManifests(), c.csrApproverManifests()...) {
+		if isManifestURL(m) {
+			continue
+		}
+		manifest, err := inlineManifest(m)
+		if err != nil {
+			return fmt.Errorf("cloudProvider: %v", err)
+		}
+		name := manifest["name"].(string)
+		if names[name] {
+			return fmt.Errorf("cloudProvider: inline manifest name %q is used twice, rename one of the files", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ControlPlaneConfig — аргументы компонентов control plane (секция controlPlane: в cluster.yaml)
+type ControlPlaneConfig struct {
+	APIServer         *ComponentConfig `yaml:"apiServer,omitempty"`
+	ControllerManager *ComponentConfig `yaml:"controllerManager,omitempty"`
+	Scheduler         *ComponentConfig `yaml:"scheduler,omitempty"`
+	Etcd              *ComponentConfig `yaml:"etcd,omitempty"`
+	// FeatureGates применяются ко всем компонентам Kubernetes (apiServer, controllerManager, scheduler)
+	FeatureGates map[string]bool `yaml:"featureGates,omitempty"`
+	// ExposeMetrics открывает метрики controller-manager, scheduler и etcd для Prometheus
+	ExposeMetrics bool `yaml:"exposeMetrics,omitempty"`
+}
+
+// ComponentConfig — настройки одного компонента control plane
+type ComponentConfig struct {
+	ExtraArgs    map[string]string `yaml:"extraArgs,omitempty"`
+	FeatureGates map[string]bool   `yaml:"featureGates,omitempty"`
+	ExtraVolumes []ExtraVolume     `yaml:"extraVolumes,omitempty"`
+}
+
+// ExtraVolume — каталог хоста, смонтированный в под компонента (cluster.<component>.extraVolumes)
+type ExtraVolume struct {
+	HostPath  string `yaml:"hostPath"`
+	MountPath string `yaml:"mountPath,omitempty"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
+}
+
+// metricsArgs — аргументы, с которыми метрики компонентов доступны Prometheus снаружи ноды
+var metricsArgs = map[string]map[string]string{
+	"controllerManager": {"bind-address": "0.0.0.0"},
+	"scheduler":         {"bind-address": "0.0.0.0"},
+	"etcd":              {"listen-metrics-urls": "http://0.0.0.0:2381"},
+}
+
+// components возвращает компоненты в порядке cluster.* патча
+func (c *ControlPlaneConfig) components() []struct {
+	name string
+	cfg  *ComponentConfig
+} {
+	return []struct {
+		name string
+		cfg  *ComponentConfig
+	}{
+		{"apiServer", c.APIServer},
+		{"controllerManager", c.ControllerManager},
+		{"scheduler", c.Scheduler},
+		{"etcd", c.Etcd},
+	}
+}
+
+// featureGatesArg собирает значение --feature-gates: общие gates, затем gates компонента
+func featureGatesArg(common, component map[string]bool) string {
+	gates := map[string]bool{}
+	for k, v := range common {
+		gates[k] = v
+	}
+	for k, v := range component {
+		gates[k] = v
+	}
+	names := make([]string, 0, len(gates))
+	for name := range gates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%t", name, gates[name]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// componentArgs возвращает cluster.<component>.extraArgs, создавая его при необходимости
+func componentArgs(cluster map[string]interface{}, component string) map[string]interface{} {
+	return nestedMap(cluster, component, "extraArgs")
+}
+
+// applyControlPlane добавляет аргументы, feature gates и тома компонентов в cluster.* patch.yaml.
+// Существующие extraArgs (например node-cidr-mask-size) сохраняются.
+func applyControlPlane(ans Answers, cluster map[string]interface{}) {
+	c := ans.ControlPlane
+	if c == nil {
+		return
+	}
+	for _, comp := range c.components() {
+		if c.ExposeMetrics {
+			for k, v := range metricsArgs[comp.name] {
+				componentArgs(cluster, comp.name)[k] = v
+			}
+		}
+		var gates map[string]bool
+		if comp.name != "etcd" {
+			gates = c.FeatureGates
+		}
+		cfg := comp.cfg
+		if cfg == nil {
+			cfg = &ComponentConfig{}
+		}
+		if arg := featureGatesArg(gates, cfg.FeatureGates); arg != "" {
+			componentArgs(cluster, comp.name)["feature-gates"] = arg
+		}
+		for k, v := range cfg.ExtraArgs {
+			componentArgs(cluster, comp.name)[k] = v
+		}
+		if len(cfg.ExtraVolumes) > 0 {
+			volumes, _ := nestedMap(cluster, comp.name)["extraVolumes"].([]map[string]interface{})
+			for _, v := range cfg.ExtraVolumes {
+				mountPath := v.MountPath
+				if mountPath == "" {
+					mountPath = v.HostPath
+				}
+				volume := map[string]interface{}{"hostPath": v.HostPath, "mountPath": mountPath}
+				if v.ReadOnly {
+					volume["readonly"] = true
+				}
+				volumes = append(volumes, volume)
+			}
+			nestedMap(cluster, comp.name)["extraVolumes"] = volumes
+		}
+	}
+}
+
+// validateControlPlane проверяет секцию controlPlane
+func validateControlPlane(ans Answers) error {
+	c := ans.ControlPlane
+	if c == nil {
+		return nil
+	}
+	for _, comp := range c.components() {
+		cfg := comp.cfg
+		if cfg == nil {
+			continue
+		}
+		scope := "controlPlane." + comp.name
+		for k := range cfg.ExtraArgs {
+			if k == "" || strings.HasPrefix(k, "-") {
+				return fmt.Errorf("%s.extraArgs: argument name %q must be given without leading dashes", scope, k)
+			}
+			if k == "feature-gates" && (len(cfg.FeatureGates) > 0 || (comp.name != "etcd" && len(c.FeatureGates) > 0)) {
+				return fmt.Errorf("%s.extraArgs: feature-gates conflicts with featureGates, use only one of them", scope)
+			}
+			if comp.name == "controllerManager" && strings.HasPrefix(k, "node-cidr-mask-size") {
+				return fmt.Errorf("%s.extraArgs: use nodeCIDRMaskSize/nodeCIDRMaskSize6 instead of %s", scope, k)
+			}
+		}
+		if comp.name == "etcd" && (len(cfg.FeatureGates) > 0 || len(cfg.ExtraVolumes) > 0) {
+			return fmt.Errorf("%s: only extraArgs are supported for etcd", scope)
+		}
+		for i, v := range cfg.ExtraVolumes {
+			if !strings.HasPrefix(v.HostPath, "/") || (v.MountPath != "" && !strings.HasPrefix(v.MountPath, "/")) {
+				return fmt.Errorf("%s.extraVolumes[%d]: hostPath and mountPath must be absolute paths", scope, i)
+			}
+		}
+	}
+	return nil
+}
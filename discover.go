@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	talosAPIPort       = 50000
+	maxDiscoverHosts   = 65536
+	discoverWorkers    = 128
+	defaultDialTimeout = 500 * time.Millisecond
+)
+
+// subnetHosts возвращает адреса хостов IPv4-подсети (без адреса сети и broadcast)
+func subnetHosts(cidr string) ([]net.IP, error) {
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("only IPv4 subnets can be scanned: %s", cidr)
+	}
+	ones, bits := ipnet.Mask.Size()
+	size := uint64(1) << uint(bits-ones)
+	if size > maxDiscoverHosts {
+		return nil, fmt.Errorf("subnet %s is too large to scan (max /16)", cidr)
+	}
+	start := binary.BigEndian.Uint32(ipnet.IP.To4())
+	var hosts []net.IP
+	for i := uint64(0); i < size; i++ {
+		if size > 2 && (i == 0 || i == size-1) {
+			continue
+		}
+		host := make(net.IP, 4)
+		binary.BigEndian.PutUint32(host, start+uint32(i))
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// discoverNodes ищет в подсети ноды Talos, у которых открыт порт apid (50000).
+// Ноды в maintenance mode слушают его до применения конфигурации.
+func discoverNodes(cidr string, timeout time.Duration) ([]string, error) {
+	hosts, err := subnetHosts(cidr)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	var found []net.IP
+	var wg sync.WaitGroup
+	jobs := make(chan net.IP)
+	for w := 0; w < discoverWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				conn, err := net.DialTimeout("tcp", net.JoinHostPort(host.String(), strconv.Itoa(talosAPIPort)), timeout)
+				if err != nil {
+					continue
+				}
+				conn.Close()
+				mu.Lock()
+				found = append(found, host)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, host := range hosts {
+		jobs <- host
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(found, func(i, j int) bool { return bytes.Compare(found[i], found[j]) < 0 })
+	result := make([]string, 0, len(found))
+	for _, ip := range found {
+		result = append(result, ip.String())
+	}
+	return result, nil
+}
+
+// fillDiscoveredIPs дополняет списки IP нод найденными адресами, пропуская уже занятые.
+// Первыми заполняются control plane, затем воркеры.
+func fillDiscoveredIPs(ans Answers, cpIPs, workerIPs, discovered []string, usedIPs map[string]struct{}) ([]string, []string) {
+	next := 0
+	take := func() (string, bool) {
+		for next < len(discovered) {
+			ip := discovered[next]
+			next++
+			if _, ok := usedIPs[ip]; ok {
+				continue
+			}
+			usedIPs[ip] = struct{}{}
+			return ip, true
+		}
+		return "", false
+	}
+	for len(cpIPs) < ans.CPCount {
+		ip, ok := take()
+		if !ok {
+			break
+		}
+		cpIPs = append(cpIPs, ip)
+	}
+	for len(workerIPs) < ans.WorkerCount {
+		ip, ok := take()
+		if !ok {
+			break
+		}
+		workerIPs = append(workerIPs, ip)
+	}
+	return cpIPs, workerIPs
+}
+
+func discoverCmd() *cobra.Command {
+	var subnet string
+	var timeout time.Duration
+	var showLinks bool
+
+	cmd := &cobra.Command{
+		Use:   "discover",
+		Short: "Find Talos nodes in maintenance mode",
+		Long:  `Scan an IPv4 subnet for Talos nodes with an open apid port (50000), e.g. nodes that got their address from DHCP`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if subnet == "" {
+				fmt.Printf("%sError: --subnet is required%s\n", colorRed, colorReset)
+				os.Exit(1)
+			}
+			fmt.Printf("Scanning %s ..\n", subnet)
+			nodes, err := discoverNodes(subnet, timeout)
+			if err != nil {
+				fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+				os.Exit(1)
+			}
+			if len(nodes) == 0 {
+				fmt.Printf("%sNo Talos nodes found%s\n", colorYellow, colorReset)
+				return
+			}
+			fmt.Printf("%sFound %d node(s):%s\n", colorGreen, len(nodes), colorReset)
+			for _, ip := range nodes {
+				fmt.Printf("  - %s\n", ip)
+				if !showLinks {
+					continue
+				}
+				links, err := nodeLinks(ip)
+				if err != nil {
+					fmt.Printf("%s    cannot get links: %v%s\n", colorYellow, err, colorReset)
+					continue
+				}
+				for _, l := range links {
+					fmt.Printf("    %s: hardwareAddr=%s driver=%s busPath=%s up=%v\n", l.Name, l.HardwareAddr, l.Driver, l.BusPath, l.Up)
+				}
+				if nic := suggestNIC(links); nic != nil {
+					fmt.Printf("%s    suggested: nic: {hardwareAddr: \"%s\"}%s\n", colorGreen, nic.HardwareAddr, colorReset)
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&subnet, "subnet", "", "IPv4 subnet to scan, e.g. 192.168.1.0/24")
+	cmd.Flags().DurationVar(&timeout, "timeout", defaultDialTimeout, "Connection timeout per address")
+	cmd.Flags().BoolVar(&showLinks, "links", false, "Show physical links of found nodes and suggest a MAC-based nic selector (requires talosctl)")
+	return cmd
+}
+
+// linkInfo — сетевой интерфейс ноды по данным talosctl get links
+type linkInfo struct {
+	Name         string
+	HardwareAddr string
+	Driver       string
+	BusPath      string
+	Up           bool
+}
+
+// nodeLinks получает список интерфейсов ноды в maintenance mode через talosctl
+func nodeLinks(ip string) ([]linkInfo, error) {
+	out, err := exec.Command("talosctl", "get", "links", "--insecure", "-n", ip, "-o", "json").Output()
+	if err != nil {
+		return nil, err
+	}
+	var links []linkInfo
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var res struct {
+			Metadata struct {
+				ID string `json:"id"`
+			} `json:"metadata"`
+			Spec struct {
+				HardwareAddr     string `json:"hardwareAddr"`
+				Driver           string `json:"driver"`
+				BusPath          string `json:"busPath"`
+				Kind             string `json:"kind"`
+				Type             string `json:"type"`
+				OperationalState string `json:"operationalState"`
+			} `json:"spec"`
+		}
+		if err := dec.Decode(&res); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot parse talosctl output: %v", err)
+		}
+		// физические порты: ethernet без kind (не bond/bridge/vlan) и с адресом на шине
+		if res.Spec.Type != "ether" || res.Spec.Kind != "" || res.Spec.BusPath == "" {
+			continue
+		}
+		links = append(links, linkInfo{
+			Name:         res.Metadata.ID,
+			HardwareAddr: res.Spec.HardwareAddr,
+			Driver:       res.Spec.Driver,
+			BusPath:      res.Spec.BusPath,
+			Up:           res.Spec.OperationalState == "up",
+		})
+	}
+	return links, nil
+}
+
+// suggestNIC предлагает deviceSelector по MAC для первого поднятого физического интерфейса
+func suggestNIC(links []linkInfo) *NICSelector {
+	for _, up := range []bool{true, false} {
+		for _, l := range links {
+			if l.Up == up && l.HardwareAddr != "" {
+				return &NICSelector{DeviceSelector: DeviceSelector{HardwareAddr: l.HardwareAddr}}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import "fmt"
+
+// nodeDocs — патч ноды: основной документ v1alpha1 и дополнительные документы (HostnameConfig, VolumeConfig, ...)
+type nodeDocs struct {
+	patch map[string]interface{}
+	extra []interface{}
+}
+
+func newNodeDocs() *nodeDocs {
+	return &nodeDocs{patch: map[string]interface{}{"machine": map[string]interface{}{}}}
+}
+
+func (d *nodeDocs) machine() map[string]interface{} {
+	return d.patch["machine"].(map[string]interface{})
+}
+
+// docs возвращает документы патча в порядке записи в файл
+func (d *nodeDocs) docs() []interface{} {
+	return append([]interface{}{d.patch}, d.extra...)
+}
+
+// nestedMap возвращает вложенный map по пути ключей, создавая недостающие уровни
+func nestedMap(m map[string]interface{}, keys ...string) map[string]interface{} {
+	for _, key := range keys {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[key] = next
+		}
+		m = next
+	}
+	return m
+}
+
+// talosEmitters — набор функций, которые формируют версионно-зависимые части конфигурации
+type talosEmitters struct {
+	// minMinor — минимальная версия Talos 1.<minMinor>, с которой применяется набор
+	minMinor int
+	hostname func(d *nodeDocs, hostname string)
+	network  func(d *nodeDocs, interfaces []map[string]interface{})
+	volumes  func(d *nodeDocs, ans Answers, hostname, talosVersion string)
+	// registries заполняет patch.yaml и возвращает дополнительные документы для него
+	registries func(machine map[string]interface{}, ans Answers) []interface{}
+}
+
+// talosEmitterRegistry упорядочен от новых версий Talos к старым
+var talosEmitterRegistry = []talosEmitters{
+	{minMinor: 12, hostname: hostnameDocument, network: networkDocuments, volumes: volumeDocuments, registries: registryMirrorDocuments},
+	{minMinor: 0, hostname: hostnameLegacy, network: networkInterfaces, volumes: volumesLegacy, registries: registryMirrors},
+}
+
+// emittersFor возвращает набор эмиттеров для версии Talos (без 'v').
+// Неизвестная версия считается старой, как и в isTalos112OrNewer.
+func emittersFor(talosVersion string) talosEmitters {
+	for _, e := range talosEmitterRegistry {
+		if isTalosVersionAtLeast(talosVersion, 1, e.minMinor) {
+			return e
+		}
+	}
+	return talosEmitterRegistry[len(talosEmitterRegistry)-1]
+}
+
+// hostnameDocument — Talos >= 1.12: hostname в отдельном документе HostnameConfig сразу после основного
+func hostnameDocument(d *nodeDocs, hostname string) {
+	if network, ok := d.machine()["network"].(map[string]interface{}); ok {
+		delete(network, "hostname")
+	}
+	doc := map[string]interface{}{
+		"apiVersion": "v1alpha1",
+		"kind":       "HostnameConfig",
+		"hostname":   hostname,
+	}
+	d.extra = append([]interface{}{doc}, d.extra...)
+}
+
+// hostnameLegacy — Talos < 1.12: hostname в machine.network.hostname
+func hostnameLegacy(d *nodeDocs, hostname string) {
+	network, ok := d.machine()["network"].(map[string]interface{})
+	if !ok {
+		network = map[string]interface{}{}
+		d.machine()["network"] = network
+	}
+	network["hostname"] = hostname
+}
+
+// networkInterfaces — Talos < 1.12: интерфейсы ноды в machine.network.interfaces
+func networkInterfaces(d *nodeDocs, interfaces []map[string]interface{}) {
+	network, ok := d.machine()["network"].(map[string]interface{})
+	if !ok {
+		network = map[string]interface{}{}
+		d.machine()["network"] = network
+	}
+	network["interfaces"] = interfaces
+}
+
+// networkDocuments — Talos >= 1.12: интерфейсы ноды документами LinkConfig, BondConfig, BridgeConfig,
+// VLANConfig, DHCPv4Config и Layer2VIPConfig. Интерфейсы, выбранные по deviceSelector,
+// получают имя через LinkAliasConfig (net0, net1, ...): селектор должен находить ровно один интерфейс.
+func networkDocuments(d *nodeDocs, interfaces []map[string]interface{}) {
+	var aliases, links []interface{}
+	alias := func(selector DeviceSelector) string {
+		name := fmt.Sprintf("net%d", len(aliases))
+		aliases = append(aliases, map[string]interface{}{
+			"apiVersion": "v1alpha1",
+			"kind":       "LinkAliasConfig",
+			"name":       name,
+			"selector":   map[string]interface{}{"match": selector.celExpr()},
+		})
+		return name
+	}
+	for _, iface := range interfaces {
+		name, _ := iface["interface"].(string)
+		if selector, ok := iface["deviceSelector"].(DeviceSelector); ok {
+			name = alias(selector)
+		}
+		doc := linkDocument("LinkConfig", name, iface)
+		if bond, ok := iface["bond"].(map[string]interface{}); ok {
+			doc = linkDocument("BondConfig", name, iface)
+			ports, _ := bond["interfaces"].([]string)
+			ports = append([]string{}, ports...)
+			selectors, _ := bond["deviceSelectors"].([]DeviceSelector)
+			for _, selector := range selectors {
+				ports = append(ports, alias(selector))
+			}
+			doc["links"] = ports
+			doc["bondMode"] = bond["mode"]
+			for _, key := range []string{"miimon", "lacpRate"} {
+				if value, ok := bond[key]; ok {
+					doc[key] = value
+				}
+			}
+		}
+		if bridge, ok := iface["bridge"].(map[string]interface{}); ok {
+			doc = linkDocument("BridgeConfig", name, iface)
+			doc["links"] = bridge["interfaces"]
+			doc["stp"] = bridge["stp"]
+		}
+		links = append(links, doc)
+		if dhcp, _ := iface["dhcp"].(bool); dhcp {
+			links = append(links, dhcpDocument(name))
+		}
+		vlans, _ := iface["vlans"].([]map[string]interface{})
+		for _, vlan := range vlans {
+			vlanName := fmt.Sprintf("%s.%v", name, vlan["vlanId"])
+			doc := linkDocument("VLANConfig", vlanName, vlan)
+			doc["vlanID"] = vlan["vlanId"]
+			doc["parent"] = name
+			links = append(links, doc)
+			if dhcp, _ := vlan["dhcp"].(bool); dhcp {
+				links = append(links, dhcpDocument(vlanName))
+			}
+		}
+		if vip, ok := iface["vip"].(map[string]interface{}); ok {
+			links = append(links, map[string]interface{}{
+				"apiVersion": "v1alpha1",
+				"kind":       "Layer2VIPConfig",
+				"name":       vip["ip"],
+				"link":       name,
+			})
+		}
+	}
+	d.extra = append(d.extra, aliases...)
+	d.extra = append(d.extra, links...)
+}
+
+// linkDocument формирует документ интерфейса с общими полями: адреса, маршруты и MTU
+// из записи machine.network.interfaces (или ее vlans)
+func linkDocument(kind, name string, iface map[string]interface{}) map[string]interface{} {
+	doc := map[string]interface{}{
+		"apiVersion": "v1alpha1",
+		"kind":       kind,
+		"name":       name,
+		"up":         true,
+	}
+	if mtu, ok := iface["mtu"]; ok {
+		doc["mtu"] = mtu
+	}
+	addresses, _ := iface["addresses"].([]string)
+	var addressDocs []map[string]interface{}
+	for _, address := range addresses {
+		addressDocs = append(addressDocs, map[string]interface{}{"address": address})
+	}
+	if len(addressDocs) > 0 {
+		doc["addresses"] = addressDocs
+	}
+	routes, _ := iface["routes"].([]map[string]interface{})
+	var routeDocs []map[string]interface{}
+	for _, route := range routes {
+		routeDoc := map[string]interface{}{"destination": route["network"]}
+		for _, key := range []string{"gateway", "source", "metric", "mtu", "table"} {
+			if value, ok := route[key]; ok {
+				routeDoc[key] = value
+			}
+		}
+		routeDocs = append(routeDocs, routeDoc)
+	}
+	if len(routeDocs) > 0 {
+		doc["routes"] = routeDocs
+	}
+	return doc
+}
+
+// dhcpDocument включает DHCPv4 на интерфейсе
+func dhcpDocument(link string) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1alpha1",
+		"kind":       "DHCPv4Config",
+		"name":       link,
+	}
+}
+
+// volumeDocuments — Talos >= 1.12: шифрование и пользовательские тома документами VolumeConfig/UserVolumeConfig
+func volumeDocuments(d *nodeDocs, ans Answers, hostname, talosVersion string) {
+	d.extra = append(d.extra, systemVolumeDocs(ans, hostname, d.patch, talosVersion, true)...)
+	d.extra = append(d.extra, applyUserVolumes(ans, hostname, d.patch, true)...)
+}
+
+// volumesLegacy — Talos < 1.12: machine.systemDiskEncryption и machine.disks
+func volumesLegacy(d *nodeDocs, ans Answers, hostname, talosVersion string) {
+	d.extra = append(d.extra, systemVolumeDocs(ans, hostname, d.patch, talosVersion, false)...)
+	applyUserVolumes(ans, hostname, d.patch, false)
+}
+
+// systemVolumeDocs собирает настройки системных томов: шифрование, размер EPHEMERAL, кеш образов
+func systemVolumeDocs(ans Answers, hostname string, nodePatch map[string]interface{}, talosVersion string, newFormat bool) []interface{} {
+	docs := applyEncryption(ans, hostname, nodePatch, newFormat)
+	docs = applyEphemeral(ans, hostname, docs)
+	return applyImageCache(ans, docs, talosVersion)
+}
+
+// registryMirrorEndpoints — зеркала docker.io
+var registryMirrorEndpoints = []string{"https://mirror.gcr.io", "https://dockerhub.timeweb.cloud"}
+
+// registryMirrors — Talos < 1.12: зеркала docker.io в machine.registries
+func registryMirrors(machine map[string]interface{}, ans Answers) []interface{} {
+	if !ans.UseMirrors {
+		return nil
+	}
+	machine["registries"] = map[string]interface{}{
+		"mirrors": map[string]interface{}{
+			"docker.io": map[string]interface{}{"endpoints": registryMirrorEndpoints},
+		},
+	}
+	return nil
+}
+
+// registryMirrorDocuments — Talos >= 1.12: зеркала docker.io документом RegistryMirrorConfig
+func registryMirrorDocuments(machine map[string]interface{}, ans Answers) []interface{} {
+	if !ans.UseMirrors {
+		return nil
+	}
+	var endpoints []map[string]interface{}
+	for _, url := range registryMirrorEndpoints {
+		endpoints = append(endpoints, map[string]interface{}{"url": url})
+	}
+	return []interface{}{map[string]interface{}{
+		"apiVersion": "v1alpha1",
+		"kind":       "RegistryMirrorConfig",
+		"name":       "docker.io",
+		"endpoints":  endpoints,
+	}}
+}
+
+// nodePatchDocs формирует все документы патча ноды для версии Talos
+func nodePatchDocs(ans Answers, spec nodeSpec, talosVersion string) ([]interface{}, error) {
+	e := emittersFor(talosVersion)
+	d := newNodeDocs()
+	interfaces := nodeInterfaces(ans, spec)
+	if spec.IsCP && ans.UseVIP && ans.VIPIP != "" {
+		interfaces[0]["vip"] = map[string]interface{}{"ip": ans.VIPIP}
+	}
+	e.network(d, interfaces)
+	e.hostname(d, spec.Hostname)
+
+	machine := d.machine()
+	applyKubelet(ans, spec.Hostname, machine)
+	if maxPods := nodeMaxPods(ans, spec.Hostname); maxPods > 0 {
+		nestedMap(machine, "kubelet", "extraConfig")["maxPods"] = maxPods
+	}
+	if installDiskPerNode(ans) {
+		machine["install"] = nodeInstallDisk(ans, spec.Hostname)
+	}
+	if spec.IsCP && len(ans.EtcdAdvertisedSubnets) > 0 {
+		d.patch["cluster"] = map[string]interface{}{
+			"etcd": map[string]interface{}{"advertisedSubnets": ans.EtcdAdvertisedSubnets},
+		}
+	}
+	if spec.IsCP {
+		if err := applyOIDCFiles(ans, machine); err != nil {
+			return nil, err
+		}
+		if err := applyAuditFiles(ans, machine); err != nil {
+			return nil, err
+		}
+		applyTalosAPIAccess(ans, machine)
+	}
+	applyNodeLabels(ans, spec.Hostname, machine)
+	// модули ядра нужны везде, где работает хранилище: на воркерах и на control plane с нагрузкой
+	if ans.UseDRBD && (!spec.IsCP || cpSchedulingAllowed(ans)) {
+		machine["kernel"] = map[string]interface{}{"modules": kernelModules(ans)}
+	}
+
+	e.volumes(d, ans, spec.Hostname, talosVersion)
+	return d.docs(), nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// renderDocs кодирует документы так же, как fileWriteYAMLDocs
+func renderDocs(t *testing.T, docs []interface{}) string {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+	}
+	return buf.String()
+}
+
+func TestNodePatchDocsPerTalosVersion(t *testing.T) {
+	ans := Answers{
+		Iface:   "eth0",
+		Gateway: "10.0.0.1",
+		Netmask: "24",
+		Encryption: &EncryptionConfig{
+			Volumes: []string{volumeEphemeral},
+			Keys:    []EncryptionKey{{NodeID: true}},
+		},
+		ImageCache: &ImageCacheConfig{Enabled: true, MaxSize: "5GB"},
+		Groups: map[string]NodeConfig{
+			groupWorker: {Volumes: []VolumeSpec{{Name: "data", Disk: "/dev/sdb", Size: "10GB"}}},
+		},
+	}
+	spec := newNodeSpec(ans, false, 0, "10.0.0.5")
+
+	const interfaces = `    interfaces:
+      - addresses:
+          - 10.0.0.5/24
+        deviceSelector:
+          physical: true
+        dhcp: false
+        routes:
+          - gateway: 10.0.0.1
+            network: 0.0.0.0/0
+`
+	const legacyEncryption = `  systemDiskEncryption:
+    ephemeral:
+      keys:
+        - nodeID: {}
+          slot: 0
+      provider: luks2
+`
+	const legacyDisks = `machine:
+  disks:
+    - device: /dev/sdb
+      partitions:
+        - mountpoint: /var/mnt/data
+          size: 10GB
+  network:
+    hostname: worker-1
+`
+	const imageCache = `---
+apiVersion: v1alpha1
+kind: VolumeConfig
+name: IMAGECACHE
+provisioning:
+  maxSize: 5GB
+`
+
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{
+			version: "1.9.5",
+			want:    legacyDisks + interfaces + legacyEncryption,
+		},
+		{
+			version: "1.10.7",
+			want:    legacyDisks + interfaces + legacyEncryption + imageCache,
+		},
+		{
+			version: "1.11.5",
+			want:    legacyDisks + interfaces + legacyEncryption + imageCache,
+		},
+		{
+			version: "1.12.6",
+			want: `machine: {}
+---
+apiVersion: v1alpha1
+hostname: worker-1
+kind: HostnameConfig
+---
+apiVersion: v1alpha1
+kind: LinkAliasConfig
+name: net0
+selector:
+  match: link.type == 1 && link.kind == ""
+---
+addresses:
+  - address: 10.0.0.5/24
+apiVersion: v1alpha1
+kind: LinkConfig
+name: net0
+routes:
+  - destination: 0.0.0.0/0
+    gateway: 10.0.0.1
+up: true
+---
+apiVersion: v1alpha1
+encryption:
+  keys:
+    - nodeID: {}
+      slot: 0
+  provider: luks2
+kind: VolumeConfig
+name: EPHEMERAL
+` + imageCache + `---
+apiVersion: v1alpha1
+kind: UserVolumeConfig
+name: data
+provisioning:
+  diskSelector:
+    match: disk.dev_path == '/dev/sdb'
+  maxSize: 10GB
+  minSize: 10GB
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			docs, err := nodePatchDocs(ans, spec, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := renderDocs(t, docs)
+			if got != tt.want {
+				t.Errorf("unexpected patch for Talos %s:\n--- got ---\n%s\n--- want ---\n%s", tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmittersFor(t *testing.T) {
+	tests := []struct {
+		version  string
+		minMinor int
+	}{
+		{"", 0},
+		{"1.7.0", 0},
+		{"1.11.5", 0},
+		{"1.12.0", 12},
+		{"1.13.1", 12},
+		{"2.0.0", 12},
+	}
+	for _, tt := range tests {
+		if got := emittersFor(tt.version).minMinor; got != tt.minMinor {
+			t.Errorf("emittersFor(%q).minMinor = %d, want %d", tt.version, got, tt.minMinor)
+		}
+	}
+}
+
+func TestNetworkDocumentsBondVLANVIP(t *testing.T) {
+	ans := Answers{
+		Gateway: "10.0.0.1",
+		Netmask: "24",
+		UseVIP:  true,
+		VIPIP:   "10.0.0.100",
+		Bond: &BondConfig{
+			Interfaces:      []string{"eth0"},
+			DeviceSelectors: []DeviceSelector{{HardwareAddr: "AA:BB:CC:*"}},
+		},
+		VLANs: []VLANConfig{{VLANID: 20, Netmask: "24", DHCP: true, Routes: []RouteConfig{{Network: "10.20.0.0/16", Gateway: "10.0.20.1", Table: "100"}}}},
+	}
+	docs, err := nodePatchDocs(ans, newNodeSpec(ans, true, 0, "10.0.0.5"), "1.12.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `machine: {}
+---
+apiVersion: v1alpha1
+hostname: cp-1
+kind: HostnameConfig
+---
+apiVersion: v1alpha1
+kind: LinkAliasConfig
+name: net0
+selector:
+  match: glob("aa:bb:cc:*", mac(link.permanent_addr))
+---
+addresses:
+  - address: 10.0.0.5/24
+apiVersion: v1alpha1
+bondMode: 802.3ad
+kind: BondConfig
+links:
+  - eth0
+  - net0
+miimon: 100
+name: bond0
+routes:
+  - destination: 0.0.0.0/0
+    gateway: 10.0.0.1
+up: true
+---
+apiVersion: v1alpha1
+kind: VLANConfig
+name: bond0.20
+parent: bond0
+routes:
+  - destination: 10.20.0.0/16
+    gateway: 10.0.20.1
+    table: 100
+up: true
+vlanID: 20
+---
+apiVersion: v1alpha1
+kind: DHCPv4Config
+name: bond0.20
+---
+apiVersion: v1alpha1
+kind: Layer2VIPConfig
+link: bond0
+name: 10.0.0.100
+`
+	if got := renderDocs(t, docs); got != want {
+		t.Errorf("unexpected patch:\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+func TestRegistryMirrorsPerTalosVersion(t *testing.T) {
+	ans := Answers{UseMirrors: true}
+
+	machine := map[string]interface{}{}
+	if docs := emittersFor("1.11.5").registries(machine, ans); docs != nil {
+		t.Errorf("legacy registries must not add documents, got %v", docs)
+	}
+	if _, ok := machine["registries"]; !ok {
+		t.Errorf("legacy registries must fill machine.registries")
+	}
+
+	machine = map[string]interface{}{}
+	docs := emittersFor("1.12.6").registries(machine, ans)
+	if _, ok := machine["registries"]; ok {
+		t.Errorf("machine.registries must not be set for Talos 1.12")
+	}
+	want := `apiVersion: v1alpha1
+endpoints:
+  - url: https://mirror.gcr.io
+  - url: https://dockerhub.timeweb.cloud
+kind: RegistryMirrorConfig
+name: docker.io
+`
+	if got := renderDocs(t, docs); got != want {
+		t.Errorf("unexpected registry documents:\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+func TestNodePatchDocsOIDCCAFileError(t *testing.T) {
+	ans := Answers{
+		Iface:   "eth0",
+		Gateway: "10.0.0.1",
+		Netmask: "24",
+		OIDC:    &OIDCConfig{IssuerURL: "https://issuer.example.com", ClientID: "kubernetes", CAFile: "/nonexistent/ca.crt"},
+	}
+	if _, err := nodePatchDocs(ans, newNodeSpec(ans, true, 0, "10.0.0.5"), "1.12.6"); err == nil || !strings.Contains(err.Error(), "oidc.caFile") {
+		t.Errorf("expected oidc.caFile error, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// factoryClient — минимальный клиент HTTP API Image Factory
+type factoryClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+func newFactoryClient(baseURL string) *factoryClient {
+	return &factoryClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// RegisterSchematic отправляет schematic в Image Factory (POST /schematics) и возвращает его ID
+func (c *factoryClient) RegisterSchematic(s *SchematicConfig) (string, error) {
+	body, err := s.Marshal()
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.http.Post(c.baseURL+"/schematics", "application/yaml", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("image factory returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var data struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", fmt.Errorf("cannot parse image factory response: %v", err)
+	}
+	return data.ID, nil
+}
+
+// registerSchematic регистрирует schematic и сверяет ID Image Factory с вычисленным локально
+func registerSchematic(c *factoryClient, s *SchematicConfig) (string, error) {
+	localID, err := s.ID()
+	if err != nil {
+		return "", fmt.Errorf("cannot build schematic: %v", err)
+	}
+	remoteID, err := c.RegisterSchematic(s)
+	if err != nil {
+		return "", err
+	}
+	if remoteID != localID {
+		return "", fmt.Errorf("schematic ID mismatch: local %s, image factory %s", localID, remoteID)
+	}
+	return remoteID, nil
+}
+
+// isoURL возвращает ссылку на ISO для schematic
+// Пример: https://factory.talos.dev/image/<id>/v1.12.6/nocloud-amd64.iso
+func (c *factoryClient) isoURL(id, talosVersion, platform, arch string) string {
+	return fmt.Sprintf("%s/image/%s/%s/%s-%s.iso", c.baseURL, id, talosVersion, platform, arch)
+}
+
+// pxeURL возвращает ссылку на iPXE-скрипт для schematic
+func (c *factoryClient) pxeURL(id, talosVersion, platform, arch string) string {
+	return fmt.Sprintf("%s/pxe/%s/%s/%s-%s", c.baseURL, id, talosVersion, platform, arch)
+}
+
+// Download скачивает файл в dest и возвращает его sha256.
+// Если expectedSHA256 задан и не совпадает, файл удаляется.
+func (c *factoryClient) Download(url, dest, expectedSHA256 string) (string, error) {
+	// без таймаута: ISO может качаться долго
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download %s: %s", url, resp.Status)
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), resp.Body); err != nil {
+		f.Close()
+		os.Remove(dest)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(sum, expectedSHA256) {
+		os.Remove(dest)
+		return sum, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", dest, expectedSHA256, sum)
+	}
+	return sum, nil
+}
+
+func imageCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "image",
+		Short: "Talos Image Factory helpers",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	cmd.AddCommand(imageBuildCmd())
+	return cmd
+}
+
+func imageBuildCmd() *cobra.Command {
+	var fromFile string
+	var factoryURL string
+	var arch string
+	var download bool
+	var output string
+	var checksum string
+
+	cmd := &cobra.Command{
+		Use:   "build",
+		Short: "Register schematic in Image Factory and print image URLs",
+		Long:  `Register schematic from cluster.yaml in Image Factory, verify its ID and print installer, ISO and PXE URLs`,
+		Run: func(cmd *cobra.Command, args []string) {
+			input, err := readFileInput(fromFile)
+			if err != nil {
+				fmt.Printf("%s%v%s\n", colorRed, err, colorReset)
+				os.Exit(1)
+			}
+			if input.Schematic == nil {
+				fmt.Printf("%sError: no schematic section in %s%s\n", colorRed, fromFile, colorReset)
+				os.Exit(1)
+			}
+			ans := answersFromInput(input)
+			if factoryURL != "" {
+				ans.Schematic.FactoryURL = factoryURL
+			}
+
+			talosVersion, err := resolveSchematicTalosVersion(ans)
+			if err != nil {
+				fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+				os.Exit(1)
+			}
+			for _, w := range missingModuleExtensions(ans) {
+				fmt.Printf("%s⚠️  %s%s\n", colorYellow, w, colorReset)
+			}
+
+			client := newFactoryClient(ans.Schematic.factoryURL())
+			remoteID, err := registerSchematic(client, ans.Schematic)
+			if err != nil {
+				fmt.Printf("%sError registering schematic: %v%s\n", colorRed, err, colorReset)
+				os.Exit(1)
+			}
+			fmt.Printf("%sSchematic registered: %s%s\n", colorGreen, remoteID, colorReset)
+			fmt.Println("--------------------------------")
+
+			platform := ans.Schematic.platform()
+			iso := client.isoURL(remoteID, talosVersion, platform, arch)
+			fmt.Printf("Installer: %s\n", installerImage(client.baseURL, platform, remoteID, talosVersion))
+			fmt.Printf("ISO:       %s\n", iso)
+			fmt.Printf("PXE:       %s\n", client.pxeURL(remoteID, talosVersion, platform, arch))
+			fmt.Println("--------------------------------")
+
+			if !download {
+				return
+			}
+			if output == "" {
+				output = fmt.Sprintf("talos-%s-%s", talosVersion, path.Base(iso))
+			}
+			fmt.Printf("Downloading %s ..\n", iso)
+			sum, err := client.Download(iso, output, checksum)
+			if err != nil {
+				fmt.Printf("%sError downloading ISO: %v%s\n", colorRed, err, colorReset)
+				os.Exit(1)
+			}
+			if checksum == "" {
+				fmt.Printf("%s⚠️  Checksum not verified (use --sha256), sha256: %s%s\n", colorYellow, sum, colorReset)
+			} else {
+				fmt.Printf("%sChecksum verified: %s%s\n", colorGreen, sum, colorReset)
+			}
+			fmt.Printf("%sCreated file: %s%s\n", colorGreen, output, colorReset)
+		},
+	}
+
+	cmd.Flags().StringVar(&fromFile, "from-file", "cluster.yaml", "YAML file with schematic section")
+	cmd.Flags().StringVar(&factoryURL, "factory-url", "", "Image Factory base URL (overrides schematic.factoryURL, default "+defaultFactoryURL+")")
+	cmd.Flags().StringVar(&arch, "arch", "amd64", "Architecture for ISO and PXE images")
+	cmd.Flags().BoolVar(&download, "download", false, "Download ISO image")
+	cmd.Flags().StringVar(&output, "output", "", "Path for downloaded ISO (default talos-<version>-<platform>-<arch>.iso)")
+	cmd.Flags().StringVar(&checksum, "sha256", "", "Expected sha256 of downloaded ISO")
+	return cmd
+}
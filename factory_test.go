@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeFactory — Image Factory, которая отвечает на POST /schematics заданным ID
+// (или sha256 от тела запроса, если ID пустой) и отдает содержимое файлов
+func fakeFactory(t *testing.T, id string, files map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/schematics" {
+			body, _ := io.ReadAll(r.Body)
+			if ct := r.Header.Get("Content-Type"); ct != "application/yaml" {
+				http.Error(w, "bad content type "+ct, http.StatusBadRequest)
+				return
+			}
+			respID := id
+			if respID == "" {
+				respID = sha256Hex(body)
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"id":%q}`, respID)
+			return
+		}
+		if content, ok := files[r.URL.Path]; ok {
+			io.WriteString(w, content)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRegisterSchematic(t *testing.T) {
+	s := &SchematicConfig{SystemExtensions: []string{"siderolabs/iscsi-tools"}}
+	want, err := s.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := fakeFactory(t, "", nil)
+	id, err := registerSchematic(newFactoryClient(srv.URL+"/"), s)
+	if err != nil {
+		t.Fatalf("registerSchematic: %v", err)
+	}
+	if id != want {
+		t.Errorf("id = %s, want %s", id, want)
+	}
+
+	srv = fakeFactory(t, emptySchematicID, nil)
+	if _, err := registerSchematic(newFactoryClient(srv.URL), s); err == nil || !strings.Contains(err.Error(), "schematic ID mismatch") {
+		t.Errorf("expected ID mismatch error, got %v", err)
+	}
+}
+
+func TestRegisterSchematicHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid schematic", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	_, err := newFactoryClient(srv.URL).RegisterSchematic(&SchematicConfig{})
+	if err == nil || !strings.Contains(err.Error(), "invalid schematic") {
+		t.Errorf("expected factory error, got %v", err)
+	}
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	const content = "talos iso"
+	sum := sha256Hex([]byte(content))
+	srv := fakeFactory(t, "", map[string]string{"/image.iso": content})
+	client := newFactoryClient(srv.URL)
+
+	tests := []struct {
+		name     string
+		expected string
+		wantErr  bool
+	}{
+		{"no checksum", "", false},
+		{"matching checksum", strings.ToUpper(sum), false},
+		{"checksum mismatch", strings.Repeat("0", 64), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "talos.iso")
+			got, err := client.Download(srv.URL+"/image.iso", dest, tt.expected)
+			if got != sum {
+				t.Errorf("sha256 = %s, want %s", got, sum)
+			}
+			_, statErr := os.Stat(dest)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+					t.Errorf("expected checksum mismatch, got %v", err)
+				}
+				if !os.IsNotExist(statErr) {
+					t.Errorf("file must be removed after checksum mismatch")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download: %v", err)
+			}
+			if data, _ := os.ReadFile(dest); string(data) != content {
+				t.Errorf("downloaded %q, want %q", data, content)
+			}
+		})
+	}
+
+	if _, err := client.Download(srv.URL+"/missing.iso", filepath.Join(t.TempDir(), "x.iso"), ""); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// kubePrismDefaultPort — порт KubePrism по умолчанию в Talos
+const kubePrismDefaultPort = 7445
+
+// FeaturesConfig — параметры machine.features. Незаданные поля оставляют значения Talos по умолчанию.
+type FeaturesConfig struct {
+	KubePrism        *KubePrismConfig `yaml:"kubePrism,omitempty"`
+	HostDNS          *HostDNSConfig   `yaml:"hostDNS,omitempty"`
+	RBAC             *bool            `yaml:"rbac,omitempty"`
+	StableHostname   *bool            `yaml:"stableHostname,omitempty"`
+	DiskQuotaSupport *bool            `yaml:"diskQuotaSupport,omitempty"`
+}
+
+// KubePrismConfig — локальный балансировщик API server на каждой ноде
+type KubePrismConfig struct {
+	Enabled *bool `yaml:"enabled,omitempty"`
+	Port    int   `yaml:"port,omitempty"`
+}
+
+// HostDNSConfig — кеширующий DNS-резолвер Talos на ноде
+type HostDNSConfig struct {
+	Enabled              *bool `yaml:"enabled,omitempty"`
+	ForwardKubeDNSToHost *bool `yaml:"forwardKubeDNSToHost,omitempty"`
+	ResolveMemberNames   *bool `yaml:"resolveMemberNames,omitempty"`
+}
+
+// kubePrismEndpoint возвращает порт KubePrism, если он включен явно или по умолчанию (Talos >= 1.6)
+func kubePrismEndpoint(ans Answers, talosVersion string) (int, bool) {
+	enabled := isTalosVersionAtLeast(talosVersion, 1, 6)
+	port := kubePrismDefaultPort
+	if f := ans.Features; f != nil && f.KubePrism != nil {
+		if f.KubePrism.Enabled != nil {
+			enabled = *f.KubePrism.Enabled
+		}
+		if f.KubePrism.Port != 0 {
+			port = f.KubePrism.Port
+		}
+	}
+	return port, enabled
+}
+
+// forwardKubeDNSToHost — пересылает ли CoreDNS запросы в host DNS (по умолчанию с Talos 1.8)
+func forwardKubeDNSToHost(ans Answers, talosVersion string) bool {
+	enabled := isTalosVersionAtLeast(talosVersion, 1, 8)
+	if f := ans.Features; f != nil && f.HostDNS != nil {
+		if f.HostDNS.Enabled != nil && !*f.HostDNS.Enabled {
+			return false
+		}
+		if f.HostDNS.ForwardKubeDNSToHost != nil {
+			enabled = *f.HostDNS.ForwardKubeDNSToHost
+		}
+	}
+	return enabled
+}
+
+// applyFeatures добавляет заданные параметры в machine.features patch.yaml
+func applyFeatures(ans Answers, machine map[string]interface{}) {
+	f := ans.Features
+	if f == nil {
+		return
+	}
+	if p := f.KubePrism; p != nil && (p.Enabled != nil || p.Port != 0) {
+		kubePrism := nestedMap(machine, "features", "kubePrism")
+		if p.Enabled != nil {
+			kubePrism["enabled"] = *p.Enabled
+		}
+		if p.Port != 0 {
+			kubePrism["port"] = p.Port
+		}
+	}
+	if h := f.HostDNS; h != nil {
+		for key, value := range map[string]*bool{
+			"enabled":              h.Enabled,
+			"forwardKubeDNSToHost": h.ForwardKubeDNSToHost,
+			"resolveMemberNames":   h.ResolveMemberNames,
+		} {
+			if value != nil {
+				nestedMap(machine, "features", "hostDNS")[key] = *value
+			}
+		}
+	}
+	for key, value := range map[string]*bool{
+		"rbac":             f.RBAC,
+		"stableHostname":   f.StableHostname,
+		"diskQuotaSupport": f.DiskQuotaSupport,
+	} {
+		if value != nil {
+			nestedMap(machine, "features")[key] = *value
+		}
+	}
+}
+
+// validateFeatures проверяет порт KubePrism и поддержку параметров версией Talos
+func validateFeatures(ans Answers, talosVersion string) error {
+	f := ans.Features
+	if f == nil {
+		return nil
+	}
+	enabled := func(v *bool) bool { return v != nil && *v }
+	if p := f.KubePrism; p != nil {
+		if p.Port < 0 || p.Port > 65535 || p.Port == 6443 || p.Port == talosAPIPort {
+			return fmt.Errorf("features.kubePrism.port: %d is not a valid free port", p.Port)
+		}
+		if enabled(p.Enabled) && !isTalosVersionAtLeast(talosVersion, 1, 5) {
+			return fmt.Errorf("features.kubePrism requires Talos >= 1.5")
+		}
+	}
+	if h := f.HostDNS; h != nil {
+		if (enabled(h.Enabled) || enabled(h.ResolveMemberNames)) && !isTalosVersionAtLeast(talosVersion, 1, 7) {
+			return fmt.Errorf("features.hostDNS requires Talos >= 1.7")
+		}
+		if enabled(h.ForwardKubeDNSToHost) {
+			if !isTalosVersionAtLeast(talosVersion, 1, 8) {
+				return fmt.Errorf("features.hostDNS.forwardKubeDNSToHost requires Talos >= 1.8")
+			}
+			if h.Enabled != nil && !*h.Enabled {
+				return fmt.Errorf("features.hostDNS.forwardKubeDNSToHost requires hostDNS.enabled")
+			}
+		}
+	}
+	if enabled(f.DiskQuotaSupport) && !isTalosVersionAtLeast(talosVersion, 1, 5) {
+		return fmt.Errorf("features.diskQuotaSupport requires Talos >= 1.5")
+	}
+	return nil
+}
+
+// ciliumInstallCommand — команда установки Cilium для Talos (kube-proxy отключен).
+// С KubePrism Cilium обращается к API server через localhost, иначе через endpoint кластера.
+func ciliumInstallCommand(ans Answers, endpoint string) string {
+	host, port := strings.Split(endpoint, "/")[0], 6443
+	talosVersion := extractTalosVersion(ans.Image)
+	if kubePrismPort, ok := kubePrismEndpoint(ans, talosVersion); ok {
+		host, port = "localhost", kubePrismPort
+	}
+	args := []string{
+		"helm install cilium cilium/cilium --namespace kube-system",
+		"--set ipam.mode=kubernetes",
+		"--set kubeProxyReplacement=true",
+		`--set securityContext.capabilities.ciliumAgent="{CHOWN,KILL,NET_ADMIN,NET_RAW,IPC_LOCK,SYS_ADMIN,SYS_RESOURCE,DAC_OVERRIDE,FOWNER,SETGID,SETUID}"`,
+		`--set securityContext.capabilities.cleanCiliumState="{NET_ADMIN,SYS_ADMIN,SYS_RESOURCE}"`,
+		"--set cgroup.autoMount.enabled=false",
+		"--set cgroup.hostRoot=/sys/fs/cgroup",
+		fmt.Sprintf("--set k8sServiceHost=%s", host),
+		fmt.Sprintf("--set k8sServicePort=%d", port),
+	}
+	// CoreDNS пересылает запросы на адрес host DNS, который недоступен через BPF host routing
+	if forwardKubeDNSToHost(ans, talosVersion) {
+		args = append(args, "--set bpf.hostLegacyRouting=true")
+	}
+	return strings.Join(args, " ")
+}
+
+// askFeatures спрашивает параметры machine.features в интерактивном режиме.
+// Вопросы о параметрах, которых нет в выбранной версии Talos, пропускаются.
+func askFeatures(talosVersion string) *FeaturesConfig {
+	if !isTalosVersionAtLeast(talosVersion, 1, 6) {
+		return nil
+	}
+	boolPtr := func(v bool) *bool { return &v }
+	f := &FeaturesConfig{}
+	kubePrism := askYesNoNumbered(fmt.Sprintf("Enable KubePrism (API server load balancer on localhost:%d, used by Cilium)?", kubePrismDefaultPort), "y")
+	f.KubePrism = &KubePrismConfig{Enabled: boolPtr(kubePrism)}
+	if kubePrism {
+		if port := mustAtoi(askNumbered(fmt.Sprintf("Enter KubePrism port [%d]: ", kubePrismDefaultPort), fmt.Sprint(kubePrismDefaultPort))); port != kubePrismDefaultPort {
+			f.KubePrism.Port = port
+		}
+	}
+	if !isTalosVersionAtLeast(talosVersion, 1, 7) {
+		return f
+	}
+	hostDNS := askYesNoNumbered("Enable host DNS cache on nodes?", "y")
+	f.HostDNS = &HostDNSConfig{Enabled: boolPtr(hostDNS)}
+	if hostDNS && isTalosVersionAtLeast(talosVersion, 1, 8) {
+		f.HostDNS.ForwardKubeDNSToHost = boolPtr(askYesNoNumbered("Forward CoreDNS queries to host DNS (forwardKubeDNSToHost)?", "y"))
+	}
+	if askYesNoNumbered("Change rbac, stableHostname or diskQuotaSupport defaults?", "n") {
+		f.RBAC = boolPtr(askYesNoNumbered("Enable Talos API RBAC?", "y"))
+		f.StableHostname = boolPtr(askYesNoNumbered("Enable stable default hostname?", "y"))
+		f.DiskQuotaSupport = boolPtr(askYesNoNumbered("Enable disk quota support for EPHEMERAL (XFS project quotas)?", "y"))
+	}
+	return f
+}
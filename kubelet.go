@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KubeletConfig — настройки kubelet на уровне кластера, группы или ноды.
+// Preset задает базовые значения, явные поля их перекрывают.
+type KubeletConfig struct {
+	Preset                      string            `yaml:"preset,omitempty"`
+	SystemReserved              map[string]string `yaml:"systemReserved,omitempty"`
+	KubeReserved                map[string]string `yaml:"kubeReserved,omitempty"`
+	EvictionHard                map[string]string `yaml:"evictionHard,omitempty"`
+	EvictionSoft                map[string]string `yaml:"evictionSoft,omitempty"`
+	EvictionSoftGracePeriod     map[string]string `yaml:"evictionSoftGracePeriod,omitempty"`
+	ImageGCHighThresholdPercent int               `yaml:"imageGCHighThresholdPercent,omitempty"`
+	ImageGCLowThresholdPercent  int               `yaml:"imageGCLowThresholdPercent,omitempty"`
+	CPUManagerPolicy            string            `yaml:"cpuManagerPolicy,omitempty"`
+	TopologyManagerPolicy       string            `yaml:"topologyManagerPolicy,omitempty"`
+	ExtraArgs                   map[string]string `yaml:"extraArgs,omitempty"`
+	ExtraMounts                 []KubeletMount    `yaml:"extraMounts,omitempty"`
+}
+
+// KubeletMount — каталог хоста, который монтируется в kubelet (machine.kubelet.extraMounts)
+type KubeletMount struct {
+	Source      string   `yaml:"source"`
+	Destination string   `yaml:"destination,omitempty"`
+	Options     []string `yaml:"options,omitempty"`
+}
+
+var (
+	cpuManagerPolicies      = map[string]bool{"none": true, "static": true}
+	topologyManagerPolicies = map[string]bool{"none": true, "best-effort": true, "restricted": true, "single-numa-node": true}
+)
+
+// kubeletPresets — готовые профили kubelet. Значения — поля KubeletConfiguration для extraConfig.
+var kubeletPresets = map[string]map[string]interface{}{
+	// default: резерв под систему и kubelet, чтобы поды не вытесняли системные сервисы
+	"default": {
+		"systemReserved":              map[string]string{"cpu": "100m", "memory": "256Mi", "ephemeral-storage": "1Gi"},
+		"kubeReserved":                map[string]string{"cpu": "100m", "memory": "256Mi", "ephemeral-storage": "1Gi"},
+		"evictionHard":                map[string]string{"memory.available": "200Mi", "nodefs.available": "10%", "imagefs.available": "15%"},
+		"imageGCHighThresholdPercent": 85,
+		"imageGCLowThresholdPercent":  80,
+	},
+	// dense: много подов на ноде — больший резерв, параллельная загрузка образов, выше лимиты API
+	"dense": {
+		"systemReserved":              map[string]string{"cpu": "500m", "memory": "1Gi", "ephemeral-storage": "2Gi"},
+		"kubeReserved":                map[string]string{"cpu": "500m", "memory": "1Gi", "ephemeral-storage": "2Gi"},
+		"evictionHard":                map[string]string{"memory.available": "500Mi", "nodefs.available": "10%", "imagefs.available": "15%"},
+		"imageGCHighThresholdPercent": 80,
+		"imageGCLowThresholdPercent":  70,
+		"serializeImagePulls":         false,
+		"kubeAPIQPS":                  50,
+		"kubeAPIBurst":                100,
+	},
+	// latency-sensitive: выделенные ядра для Guaranteed-подов (static CPU manager требует резерв CPU)
+	"latency-sensitive": {
+		"systemReserved":        map[string]string{"cpu": "500m", "memory": "512Mi"},
+		"kubeReserved":          map[string]string{"cpu": "500m", "memory": "512Mi"},
+		"evictionHard":          map[string]string{"memory.available": "500Mi", "nodefs.available": "10%"},
+		"cpuManagerPolicy":      "static",
+		"topologyManagerPolicy": "best-effort",
+	},
+	// kubevirt: выделенные ядра и NUMA-выравнивание для виртуальных машин, запас памяти под QEMU
+	"kubevirt": {
+		"systemReserved":        map[string]string{"cpu": "1", "memory": "2Gi"},
+		"kubeReserved":          map[string]string{"cpu": "500m", "memory": "1Gi"},
+		"evictionHard":          map[string]string{"memory.available": "1Gi", "nodefs.available": "10%"},
+		"cpuManagerPolicy":      "static",
+		"topologyManagerPolicy": "single-numa-node",
+	},
+}
+
+// nodeKubelet собирает настройки kubelet ноды: кластер, затем группа, затем нода
+func nodeKubelet(ans Answers, hostname string) *KubeletConfig {
+	layers := []*KubeletConfig{ans.Kubelet}
+	nodeLayers := nodeLayers(ans, hostname)
+	for i := len(nodeLayers) - 1; i >= 0; i-- {
+		layers = append(layers, nodeLayers[i].Kubelet)
+	}
+	var result *KubeletConfig
+	for _, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		if result == nil {
+			result = &KubeletConfig{}
+		}
+		result.merge(layer)
+	}
+	return result
+}
+
+// merge перекрывает настройки значениями из other; map объединяются по ключам
+func (k *KubeletConfig) merge(other *KubeletConfig) {
+	mergeMap := func(dst *map[string]string, src map[string]string) {
+		if len(src) == 0 {
+			return
+		}
+		if *dst == nil {
+			*dst = map[string]string{}
+		}
+		for key, v := range src {
+			(*dst)[key] = v
+		}
+	}
+	if other.Preset != "" {
+		k.Preset = other.Preset
+	}
+	mergeMap(&k.SystemReserved, other.SystemReserved)
+	mergeMap(&k.KubeReserved, other.KubeReserved)
+	mergeMap(&k.EvictionHard, other.EvictionHard)
+	mergeMap(&k.EvictionSoft, other.EvictionSoft)
+	mergeMap(&k.EvictionSoftGracePeriod, other.EvictionSoftGracePeriod)
+	mergeMap(&k.ExtraArgs, other.ExtraArgs)
+	if other.ImageGCHighThresholdPercent != 0 {
+		k.ImageGCHighThresholdPercent = other.ImageGCHighThresholdPercent
+	}
+	if other.ImageGCLowThresholdPercent != 0 {
+		k.ImageGCLowThresholdPercent = other.ImageGCLowThresholdPercent
+	}
+	if other.CPUManagerPolicy != "" {
+		k.CPUManagerPolicy = other.CPUManagerPolicy
+	}
+	if other.TopologyManagerPolicy != "" {
+		k.TopologyManagerPolicy = other.TopologyManagerPolicy
+	}
+	k.ExtraMounts = append(k.ExtraMounts, other.ExtraMounts...)
+}
+
+// extraConfig возвращает поля KubeletConfiguration: сначала preset, затем явные настройки
+func (k *KubeletConfig) extraConfig() map[string]interface{} {
+	cfg := map[string]interface{}{}
+	for key, v := range kubeletPresets[k.Preset] {
+		if m, ok := v.(map[string]string); ok {
+			copied := map[string]string{}
+			for mk, mv := range m {
+				copied[mk] = mv
+			}
+			v = copied
+		}
+		cfg[key] = v
+	}
+	setMap := func(key string, values map[string]string) {
+		if len(values) == 0 {
+			return
+		}
+		m, ok := cfg[key].(map[string]string)
+		if !ok {
+			m = map[string]string{}
+			cfg[key] = m
+		}
+		for mk, mv := range values {
+			m[mk] = mv
+		}
+	}
+	setMap("systemReserved", k.SystemReserved)
+	setMap("kubeReserved", k.KubeReserved)
+	setMap("evictionHard", k.EvictionHard)
+	setMap("evictionSoft", k.EvictionSoft)
+	setMap("evictionSoftGracePeriod", k.EvictionSoftGracePeriod)
+	if k.ImageGCHighThresholdPercent != 0 {
+		cfg["imageGCHighThresholdPercent"] = k.ImageGCHighThresholdPercent
+	}
+	if k.ImageGCLowThresholdPercent != 0 {
+		cfg["imageGCLowThresholdPercent"] = k.ImageGCLowThresholdPercent
+	}
+	if k.CPUManagerPolicy != "" {
+		cfg["cpuManagerPolicy"] = k.CPUManagerPolicy
+	}
+	if k.TopologyManagerPolicy != "" {
+		cfg["topologyManagerPolicy"] = k.TopologyManagerPolicy
+	}
+	return cfg
+}
+
+// applyKubelet добавляет настройки kubelet в machine.kubelet патча ноды
+func applyKubelet(ans Answers, hostname string, machine map[string]interface{}) {
+	k := nodeKubelet(ans, hostname)
+	if k == nil {
+		return
+	}
+	if cfg := k.extraConfig(); len(cfg) > 0 {
+		extraConfig := nestedMap(machine, "kubelet", "extraConfig")
+		for key, v := range cfg {
+			extraConfig[key] = v
+		}
+	}
+	if len(k.ExtraArgs) > 0 {
+		nestedMap(machine, "kubelet")["extraArgs"] = k.ExtraArgs
+	}
+	if len(k.ExtraMounts) > 0 {
+		var mounts []map[string]interface{}
+		for _, m := range k.ExtraMounts {
+			destination := m.Destination
+			if destination == "" {
+				destination = m.Source
+			}
+			options := m.Options
+			if len(options) == 0 {
+				options = []string{"bind", "rshared", "rw"}
+			}
+			mounts = append(mounts, map[string]interface{}{
+				"source":      m.Source,
+				"destination": destination,
+				"type":        "bind",
+				"options":     options,
+			})
+		}
+		nestedMap(machine, "kubelet")["extraMounts"] = mounts
+	}
+}
+
+// validateKubelet проверяет preset, политики и монтирования kubelet для каждой ноды
+func validateKubelet(ans Answers, cpIPs, workerIPs []string) error {
+	check := func(scope string, k *KubeletConfig) error {
+		if k == nil {
+			return nil
+		}
+		if k.Preset != "" {
+			if _, ok := kubeletPresets[k.Preset]; !ok {
+				presets := make([]string, 0, len(kubeletPresets))
+				for name := range kubeletPresets {
+					presets = append(presets, name)
+				}
+				sort.Strings(presets)
+				return fmt.Errorf("%skubelet: unknown preset %q (expected %s)", scope, k.Preset, strings.Join(presets, ", "))
+			}
+		}
+		if k.CPUManagerPolicy != "" && !cpuManagerPolicies[k.CPUManagerPolicy] {
+			return fmt.Errorf("%skubelet: unknown cpuManagerPolicy %q (expected none or static)", scope, k.CPUManagerPolicy)
+		}
+		if k.TopologyManagerPolicy != "" && !topologyManagerPolicies[k.TopologyManagerPolicy] {
+			return fmt.Errorf("%skubelet: unknown topologyManagerPolicy %q (expected none, best-effort, restricted or single-numa-node)", scope, k.TopologyManagerPolicy)
+		}
+		for _, p := range []int{k.ImageGCHighThresholdPercent, k.ImageGCLowThresholdPercent} {
+			if p < 0 || p > 100 {
+				return fmt.Errorf("%skubelet: image GC thresholds must be 0..100", scope)
+			}
+		}
+		for i, m := range k.ExtraMounts {
+			if !strings.HasPrefix(m.Source, "/") || (m.Destination != "" && !strings.HasPrefix(m.Destination, "/")) {
+				return fmt.Errorf("%skubelet.extraMounts[%d]: source and destination must be absolute paths", scope, i)
+			}
+		}
+		return nil
+	}
+	if err := check("", ans.Kubelet); err != nil {
+		return err
+	}
+	for name, group := range ans.Groups {
+		if err := check(fmt.Sprintf("groups.%s.", name), group.Kubelet); err != nil {
+			return err
+		}
+	}
+	for name, node := range ans.Nodes {
+		if err := check(fmt.Sprintf("nodes.%s.", name), node.Kubelet); err != nil {
+			return err
+		}
+	}
+
+	// итоговые настройки ноды: пороги GC и резерв CPU для static CPU manager
+	var hostnames []string
+	for i := range cpIPs {
+		hostnames = append(hostnames, fmt.Sprintf("cp-%d", i+1))
+	}
+	for i := range workerIPs {
+		hostnames = append(hostnames, fmt.Sprintf("worker-%d", i+1))
+	}
+	for _, hostname := range hostnames {
+		k := nodeKubelet(ans, hostname)
+		if k == nil {
+			continue
+		}
+		cfg := k.extraConfig()
+		high, _ := cfg["imageGCHighThresholdPercent"].(int)
+		low, _ := cfg["imageGCLowThresholdPercent"].(int)
+		if high != 0 && low != 0 && low >= high {
+			return fmt.Errorf("%s: kubelet imageGCLowThresholdPercent (%d) must be lower than imageGCHighThresholdPercent (%d)", hostname, low, high)
+		}
+		if cfg["cpuManagerPolicy"] == "static" {
+			system, _ := cfg["systemReserved"].(map[string]string)
+			kube, _ := cfg["kubeReserved"].(map[string]string)
+			if system["cpu"] == "" && kube["cpu"] == "" {
+				return fmt.Errorf("%s: kubelet cpuManagerPolicy static requires cpu in systemReserved or kubeReserved", hostname)
+			}
+		}
+	}
+	return nil
+}
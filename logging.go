@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// LoggingConfig — отправка логов сервисов Talos и ядра во внешние сборщики (Vector, Loki, ...)
+type LoggingConfig struct {
+	Destinations []LogDestination `yaml:"destinations,omitempty"`
+	// Kernel — адреса tcp:// или udp:// для логов ядра (kmsg)
+	Kernel []string `yaml:"kernel,omitempty"`
+}
+
+// LogDestination — получатель логов сервисов (machine.logging.destinations)
+type LogDestination struct {
+	Endpoint  string            `yaml:"endpoint"`
+	Format    string            `yaml:"format,omitempty"`
+	ExtraTags map[string]string `yaml:"extraTags,omitempty"`
+}
+
+// kmsgDocsSupported — документ KmsgLogConfig поддерживается с Talos 1.5
+func kmsgDocsSupported(talosVersion string) bool {
+	return isTalosVersionAtLeast(talosVersion, 1, 5)
+}
+
+// applyLogging добавляет machine.logging.destinations и возвращает документы KmsgLogConfig для patch.yaml
+func applyLogging(ans Answers, machine map[string]interface{}, talosVersion string) []interface{} {
+	l := ans.Logging
+	if l == nil {
+		return nil
+	}
+	if len(l.Destinations) > 0 {
+		var destinations []map[string]interface{}
+		for _, d := range l.Destinations {
+			format := d.Format
+			if format == "" {
+				format = "json_lines"
+			}
+			destination := map[string]interface{}{"endpoint": d.Endpoint, "format": format}
+			if len(d.ExtraTags) > 0 {
+				destination["extraTags"] = d.ExtraTags
+			}
+			destinations = append(destinations, destination)
+		}
+		nestedMap(machine, "logging")["destinations"] = destinations
+	}
+	if len(l.Kernel) == 0 {
+		return nil
+	}
+	if !kmsgDocsSupported(talosVersion) {
+		fmt.Printf("%s⚠️  kernel log forwarding requires Talos >= 1.5, logging.kernel is ignored%s\n", colorYellow, colorReset)
+		return nil
+	}
+	var docs []interface{}
+	for i, endpoint := range l.Kernel {
+		docs = append(docs, map[string]interface{}{
+			"apiVersion": "v1alpha1",
+			"kind":       "KmsgLogConfig",
+			"name":       fmt.Sprintf("kmsg-%d", i+1),
+			"url":        endpoint,
+		})
+	}
+	return docs
+}
+
+// validateLogEndpoint проверяет адрес вида tcp://host:port или udp://host:port
+func validateLogEndpoint(scope, endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "tcp" && u.Scheme != "udp") {
+		return fmt.Errorf("%s: %q must be tcp://host:port or udp://host:port", scope, endpoint)
+	}
+	if _, port, err := net.SplitHostPort(u.Host); err != nil || port == "" {
+		return fmt.Errorf("%s: %q must include host and port", scope, endpoint)
+	}
+	return nil
+}
+
+// validateLogging проверяет секцию logging
+func validateLogging(ans Answers) error {
+	l := ans.Logging
+	if l == nil {
+		return nil
+	}
+	for i, d := range l.Destinations {
+		scope := fmt.Sprintf("logging.destinations[%d]", i)
+		if err := validateLogEndpoint(scope, d.Endpoint); err != nil {
+			return err
+		}
+		if d.Format != "" && d.Format != "json_lines" {
+			return fmt.Errorf("%s: unknown format %q (Talos supports json_lines)", scope, d.Format)
+		}
+	}
+	for i, endpoint := range l.Kernel {
+		if err := validateLogEndpoint(fmt.Sprintf("logging.kernel[%d]", i), endpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateLogEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		wantErr  string
+	}{
+		{"tcp://10.0.0.5:5044", ""},
+		{"udp://logs.example.com:6051", ""},
+		{"tcp://[fd00::5]:5044", ""},
+		{"http://10.0.0.5:5044", "must be tcp://host:port"},
+		{"10.0.0.5:5044", "must be tcp://host:port"},
+		{"tcp://10.0.0.5", "must include host and port"},
+		{"udp://10.0.0.5:", "must include host and port"},
+		{"tcp://%zz", "must be tcp://host:port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			err := validateLogEndpoint("logging", tt.endpoint)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestApplyLogging(t *testing.T) {
+	kmsg := func(name, endpoint string) interface{} {
+		return map[string]interface{}{"apiVersion": "v1alpha1", "kind": "KmsgLogConfig", "name": name, "url": endpoint}
+	}
+	tests := []struct {
+		name         string
+		logging      *LoggingConfig
+		version      string
+		destinations []map[string]interface{}
+		docs         []interface{}
+	}{
+		{
+			name:    "no logging",
+			version: "1.12.0",
+		},
+		{
+			name: "default json_lines format",
+			logging: &LoggingConfig{Destinations: []LogDestination{
+				{Endpoint: "tcp://10.0.0.5:5044"},
+				{Endpoint: "udp://10.0.0.6:6051", Format: "json_lines", ExtraTags: map[string]string{"cluster": "prod"}},
+			}},
+			version: "1.12.0",
+			destinations: []map[string]interface{}{
+				{"endpoint": "tcp://10.0.0.5:5044", "format": "json_lines"},
+				{"endpoint": "udp://10.0.0.6:6051", "format": "json_lines", "extraTags": map[string]string{"cluster": "prod"}},
+			},
+		},
+		{
+			name:    "kernel logs as KmsgLogConfig documents",
+			logging: &LoggingConfig{Kernel: []string{"tcp://10.0.0.5:6050", "udp://10.0.0.6:6050"}},
+			version: "1.5.0",
+			docs:    []interface{}{kmsg("kmsg-1", "tcp://10.0.0.5:6050"), kmsg("kmsg-2", "udp://10.0.0.6:6050")},
+		},
+		{
+			name: "kernel logs skipped before Talos 1.5",
+			logging: &LoggingConfig{
+				Destinations: []LogDestination{{Endpoint: "tcp://10.0.0.5:5044"}},
+				Kernel:       []string{"tcp://10.0.0.5:6050"},
+			},
+			version:      "1.4.8",
+			destinations: []map[string]interface{}{{"endpoint": "tcp://10.0.0.5:5044", "format": "json_lines"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := map[string]interface{}{}
+			docs := applyLogging(Answers{Logging: tt.logging}, machine, tt.version)
+			if !reflect.DeepEqual(docs, tt.docs) {
+				t.Errorf("docs = %v, want %v", docs, tt.docs)
+			}
+			var destinations []map[string]interface{}
+			if logging, ok := machine["logging"].(map[string]interface{}); ok {
+				destinations, _ = logging["destinations"].([]map[string]interface{})
+			}
+			if !reflect.DeepEqual(destinations, tt.destinations) {
+				t.Errorf("destinations = %v, want %v", destinations, tt.destinations)
+			}
+		})
+	}
+}
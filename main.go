@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
@@ -20,7 +21,7 @@ var (
 	image      string = "factory.talos.dev/nocloud-installer/376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba:v1.12.6"
 	k8sVersion string = "1.35.2"
 	configDir  string = "config"
-	version    = "v1.4.3"
+	version           = "v1.5.0"
 )
 
 const (
@@ -51,6 +52,11 @@ func extractTalosVersion(image string) string {
 
 // isTalos112OrNewer проверяет, является ли версия >= 1.12.0
 func isTalos112OrNewer(version string) bool {
+	return isTalosVersionAtLeast(version, 1, 12)
+}
+
+// isTalosVersionAtLeast проверяет, что версия Talos (без 'v') не ниже wantMajor.wantMinor
+func isTalosVersionAtLeast(version string, wantMajor, wantMinor int) bool {
 	parts := strings.Split(version, ".")
 	if len(parts) < 2 {
 		return false
@@ -63,7 +69,7 @@ func isTalos112OrNewer(version string) bool {
 	if err != nil {
 		return false
 	}
-	return major > 1 || (major == 1 && minor >= 12)
+	return major > wantMajor || (major == wantMajor && minor >= wantMinor)
 }
 
 type Answers struct {
@@ -94,6 +100,69 @@ type Answers struct {
 	UseOVS         bool
 	UseMirrors     bool
 	UseMaxPods     bool
+	Schematic      *SchematicConfig
+	Addressing     string
+	DiscoverSubnet string
+	Nodes          map[string]NodeConfig
+	Gateway6       string
+	Netmask6       string
+	CPIPs6         []string
+	WorkerIPs6     []string
+	PodSubnets     []string
+	ServiceSubnets []string
+	Bond           *BondConfig
+	Bridge         *BridgeConfig
+	VLANs          []VLANConfig
+	NIC            *NICSelector
+	Groups         map[string]NodeConfig
+	Routes         []RouteConfig
+	GatewayOnLink  bool
+
+	InstallDiskSelector *DiskSelector
+	Encryption          *EncryptionConfig
+	Ephemeral           *EphemeralConfig
+	ImageCache          *ImageCacheConfig
+	// KubeletValidSubnets и EtcdAdvertisedSubnets закрепляют kubelet и etcd за нужной сетью
+	KubeletValidSubnets   []string
+	EtcdAdvertisedSubnets []string
+
+	// Labels, Taints, Zone и Region — метки и taints нод (machine.nodeLabels, machine.nodeTaints)
+	Labels map[string]string
+	Taints map[string]string
+	Zone   string
+	Region string
+
+	// ControlPlaneScheduling — запуск нагрузки на control plane: auto, allow или deny
+	ControlPlaneScheduling string
+
+	// MaxPods и NodeCIDRMaskSize — емкость нод: maxPods kubelet и размер pod CIDR каждой ноды
+	MaxPods           int
+	NodeCIDRMaskSize  int
+	NodeCIDRMaskSize6 int
+
+	// Настройки kubelet (preset, резервы, eviction, политики CPU/NUMA)
+	Kubelet *KubeletConfig
+
+	// Аргументы, feature gates и тома компонентов control plane
+	ControlPlane *ControlPlaneConfig
+
+	// Вход через OIDC-провайдер: флаги API server или AuthenticationConfiguration
+	OIDC *OIDCConfig
+
+	// Политика аудита API server, журнал и отправка событий во внешний сборщик
+	Audit *AuditConfig
+
+	// Отправка логов сервисов и ядра во внешние сборщики
+	Logging *LoggingConfig
+
+	// Параметры machine.features: KubePrism, host DNS, rbac, stableHostname, diskQuotaSupport
+	Features *FeaturesConfig
+
+	// Доступ подов к Talos API и ServiceAccount'ы Talos
+	TalosAPIAccess *TalosAPIAccessConfig
+
+	// Talos CCM и одобрение серверных сертификатов kubelet
+	CloudProvider *CloudProviderConfig
 }
 
 type FileInput struct {
@@ -126,6 +195,246 @@ type FileInput struct {
 	UseMaxPods     bool     `yaml:"useMaxPods"`
 	CPIPs          []string `yaml:"cpIPs"`
 	WorkerIPs      []string `yaml:"workerIPs"`
+
+	Schematic      *SchematicConfig      `yaml:"schematic,omitempty"`
+	Addressing     string                `yaml:"addressing,omitempty"`
+	DiscoverSubnet string                `yaml:"discoverSubnet,omitempty"`
+	Nodes          map[string]NodeConfig `yaml:"nodes,omitempty"`
+	Gateway6       string                `yaml:"gateway6,omitempty"`
+	Netmask6       string                `yaml:"netmask6,omitempty"`
+	CPIPs6         []string              `yaml:"cpIPs6,omitempty"`
+	WorkerIPs6     []string              `yaml:"workerIPs6,omitempty"`
+	PodSubnets     []string              `yaml:"podSubnets,omitempty"`
+	ServiceSubnets []string              `yaml:"serviceSubnets,omitempty"`
+	Bond           *BondConfig           `yaml:"bond,omitempty"`
+	Bridge         *BridgeConfig         `yaml:"bridge,omitempty"`
+	VLANs          []VLANConfig          `yaml:"vlans,omitempty"`
+	NIC            *NICSelector          `yaml:"nic,omitempty"`
+	Groups         map[string]NodeConfig `yaml:"groups,omitempty"`
+	Routes         []RouteConfig         `yaml:"routes,omitempty"`
+	GatewayOnLink  bool                  `yaml:"gatewayOnLink,omitempty"`
+
+	InstallDiskSelector *DiskSelector     `yaml:"installDiskSelector,omitempty"`
+	Encryption          *EncryptionConfig `yaml:"encryption,omitempty"`
+	Ephemeral           *EphemeralConfig  `yaml:"ephemeral,omitempty"`
+	ImageCache          *ImageCacheConfig `yaml:"imageCache,omitempty"`
+
+	KubeletValidSubnets   []string `yaml:"kubeletValidSubnets,omitempty"`
+	EtcdAdvertisedSubnets []string `yaml:"etcdAdvertisedSubnets,omitempty"`
+
+	Labels map[string]string `yaml:"labels,omitempty"`
+	Taints map[string]string `yaml:"taints,omitempty"`
+	Zone   string            `yaml:"zone,omitempty"`
+	Region string            `yaml:"region,omitempty"`
+
+	ControlPlaneScheduling string `yaml:"controlPlaneScheduling,omitempty"`
+
+	MaxPods           int `yaml:"maxPods,omitempty"`
+	NodeCIDRMaskSize  int `yaml:"nodeCIDRMaskSize,omitempty"`
+	NodeCIDRMaskSize6 int `yaml:"nodeCIDRMaskSize6,omitempty"`
+
+	Kubelet *KubeletConfig `yaml:"kubelet,omitempty"`
+
+	ControlPlane *ControlPlaneConfig `yaml:"controlPlane,omitempty"`
+
+	OIDC *OIDCConfig `yaml:"oidc,omitempty"`
+
+	Audit *AuditConfig `yaml:"audit,omitempty"`
+
+	Logging *LoggingConfig `yaml:"logging,omitempty"`
+
+	Features *FeaturesConfig `yaml:"features,omitempty"`
+
+	TalosAPIAccess *TalosAPIAccessConfig `yaml:"talosAPIAccess,omitempty"`
+
+	CloudProvider *CloudProviderConfig `yaml:"cloudProvider,omitempty"`
+}
+
+// readFileInput читает cluster.yaml (файл ответов для неинтерактивного режима)
+func readFileInput(path string) (FileInput, error) {
+	var input FileInput
+	f, err := os.Open(path)
+	if err != nil {
+		return input, fmt.Errorf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	if err := dec.Decode(&input); err != nil {
+		return input, fmt.Errorf("Failed to parse YAML: %v", err)
+	}
+	return input, nil
+}
+
+// answersFromInput переносит параметры из cluster.yaml в Answers
+func answersFromInput(input FileInput) Answers {
+	return Answers{
+		ClusterName:    input.ClusterName,
+		K8sVersion:     input.K8sVersion,
+		Image:          input.Image,
+		DownloadImage:  input.DownloadImage,
+		Iface:          input.Iface,
+		CPCount:        input.CPCount,
+		WorkerCount:    input.WorkerCount,
+		Gateway:        input.Gateway,
+		Netmask:        input.Netmask,
+		DNS1:           input.DNS1,
+		DNS2:           input.DNS2,
+		NTP1:           input.NTP1,
+		NTP2:           input.NTP2,
+		NTP3:           input.NTP3,
+		UseVIP:         input.UseVIP,
+		VIPIP:          input.VIPIP,
+		UseExtBalancer: input.UseExtBalancer,
+		ExtBalancerIP:  input.ExtBalancerIP,
+		Disk:           input.Disk,
+		UseDRBD:        input.UseDRBD,
+		UseZFS:         input.UseZFS,
+		UseSPL:         input.UseSPL,
+		UseVFIOPCI:     input.UseVFIOPCI,
+		UseVFIOIOMMU:   input.UseVFIOIOMMU,
+		UseOVS:         input.UseOVS,
+		UseMirrors:     input.UseMirrors,
+		UseMaxPods:     input.UseMaxPods,
+		Schematic:      input.Schematic,
+		Addressing:     input.Addressing,
+		DiscoverSubnet: input.DiscoverSubnet,
+		Nodes:          input.Nodes,
+		Gateway6:       input.Gateway6,
+		Netmask6:       input.Netmask6,
+		CPIPs6:         input.CPIPs6,
+		WorkerIPs6:     input.WorkerIPs6,
+		PodSubnets:     input.PodSubnets,
+		ServiceSubnets: input.ServiceSubnets,
+		Bond:           input.Bond,
+		Bridge:         input.Bridge,
+		VLANs:          input.VLANs,
+		NIC:            input.NIC,
+		Groups:         input.Groups,
+		Routes:         input.Routes,
+		GatewayOnLink:  input.GatewayOnLink,
+
+		InstallDiskSelector: input.InstallDiskSelector,
+		Encryption:          input.Encryption,
+		Ephemeral:           input.Ephemeral,
+		ImageCache:          input.ImageCache,
+
+		KubeletValidSubnets:   input.KubeletValidSubnets,
+		EtcdAdvertisedSubnets: input.EtcdAdvertisedSubnets,
+
+		Labels: input.Labels,
+		Taints: input.Taints,
+		Zone:   input.Zone,
+		Region: input.Region,
+
+		ControlPlaneScheduling: input.ControlPlaneScheduling,
+
+		MaxPods:           input.MaxPods,
+		NodeCIDRMaskSize:  input.NodeCIDRMaskSize,
+		NodeCIDRMaskSize6: input.NodeCIDRMaskSize6,
+
+		Kubelet: input.Kubelet,
+
+		ControlPlane: input.ControlPlane,
+
+		OIDC: input.OIDC,
+
+		Audit: input.Audit,
+
+		Logging: input.Logging,
+
+		Features: input.Features,
+
+		TalosAPIAccess: input.TalosAPIAccess,
+
+		CloudProvider: input.CloudProvider,
+	}
+}
+
+// inputFromAnswers собирает cluster.yaml из ответов мастера и списков IP нод
+func inputFromAnswers(ans Answers, cpIPs, workerIPs []string) FileInput {
+	return FileInput{
+		ClusterName:    ans.ClusterName,
+		K8sVersion:     ans.K8sVersion,
+		Image:          ans.Image,
+		DownloadImage:  ans.DownloadImage,
+		Iface:          ans.Iface,
+		CPCount:        ans.CPCount,
+		WorkerCount:    ans.WorkerCount,
+		Gateway:        ans.Gateway,
+		Netmask:        ans.Netmask,
+		DNS1:           ans.DNS1,
+		DNS2:           ans.DNS2,
+		NTP1:           ans.NTP1,
+		NTP2:           ans.NTP2,
+		NTP3:           ans.NTP3,
+		UseVIP:         ans.UseVIP,
+		VIPIP:          ans.VIPIP,
+		UseExtBalancer: ans.UseExtBalancer,
+		ExtBalancerIP:  ans.ExtBalancerIP,
+		Disk:           ans.Disk,
+		UseDRBD:        ans.UseDRBD,
+		UseZFS:         ans.UseZFS,
+		UseSPL:         ans.UseSPL,
+		UseVFIOPCI:     ans.UseVFIOPCI,
+		UseVFIOIOMMU:   ans.UseVFIOIOMMU,
+		UseOVS:         ans.UseOVS,
+		UseMirrors:     ans.UseMirrors,
+		UseMaxPods:     ans.UseMaxPods,
+		CPIPs:          cpIPs,
+		WorkerIPs:      workerIPs,
+		Schematic:      ans.Schematic,
+		Addressing:     ans.Addressing,
+		DiscoverSubnet: ans.DiscoverSubnet,
+		Nodes:          ans.Nodes,
+		Gateway6:       ans.Gateway6,
+		Netmask6:       ans.Netmask6,
+		CPIPs6:         ans.CPIPs6,
+		WorkerIPs6:     ans.WorkerIPs6,
+		PodSubnets:     ans.PodSubnets,
+		ServiceSubnets: ans.ServiceSubnets,
+		Bond:           ans.Bond,
+		Bridge:         ans.Bridge,
+		VLANs:          ans.VLANs,
+		NIC:            ans.NIC,
+		Groups:         ans.Groups,
+		Routes:         ans.Routes,
+		GatewayOnLink:  ans.GatewayOnLink,
+
+		InstallDiskSelector: ans.InstallDiskSelector,
+		Encryption:          ans.Encryption,
+		Ephemeral:           ans.Ephemeral,
+		ImageCache:          ans.ImageCache,
+
+		KubeletValidSubnets:   ans.KubeletValidSubnets,
+		EtcdAdvertisedSubnets: ans.EtcdAdvertisedSubnets,
+
+		Labels: ans.Labels,
+		Taints: ans.Taints,
+		Zone:   ans.Zone,
+		Region: ans.Region,
+
+		ControlPlaneScheduling: ans.ControlPlaneScheduling,
+
+		MaxPods:           ans.MaxPods,
+		NodeCIDRMaskSize:  ans.NodeCIDRMaskSize,
+		NodeCIDRMaskSize6: ans.NodeCIDRMaskSize6,
+
+		Kubelet: ans.Kubelet,
+
+		ControlPlane: ans.ControlPlane,
+
+		OIDC: ans.OIDC,
+
+		Audit: ans.Audit,
+
+		Logging: ans.Logging,
+
+		Features: ans.Features,
+
+		TalosAPIAccess: ans.TalosAPIAccess,
+
+		CloudProvider: ans.CloudProvider,
+	}
 }
 
 // getTalosctlVersion возвращает версию клиента talosctl без префикса 'v' (например, "1.12.4")
@@ -308,6 +617,32 @@ func askYesNoNumbered(prompt, def string) bool {
 	}
 }
 
+// ipPrompt добавляет к вопросу адрес по умолчанию, если он есть (например, найденный discover)
+func ipPrompt(prompt, def string) string {
+	if def == "" {
+		return prompt + ": "
+	}
+	return fmt.Sprintf("%s [%s]: ", prompt, def)
+}
+
+// askNodeMAC спрашивает MAC-адрес интерфейса ноды и сохраняет его в nodes.<hostname>.nic.
+// Если нода доступна в maintenance mode, MAC предлагается по данным talosctl get links.
+func askNodeMAC(ans *Answers, hostname, ip string) {
+	def := ""
+	if links, err := nodeLinks(ip); err == nil {
+		if nic := suggestNIC(links); nic != nil {
+			def = nic.HardwareAddr
+		}
+	}
+	mac := askNumbered(ipPrompt(fmt.Sprintf("Enter MAC address of network interface for %s", hostname), def), def)
+	if ans.Nodes == nil {
+		ans.Nodes = map[string]NodeConfig{}
+	}
+	node := ans.Nodes[hostname]
+	node.NIC = &NICSelector{DeviceSelector: DeviceSelector{HardwareAddr: mac}}
+	ans.Nodes[hostname] = node
+}
+
 func mustAtoi(val string) int {
 	i, err := strconv.Atoi(val)
 	if err != nil {
@@ -318,6 +653,11 @@ func mustAtoi(val string) int {
 }
 
 func fileWriteYAML(path string, data interface{}) {
+	fileWriteYAMLDocs(path, data)
+}
+
+// fileWriteYAMLDocs записывает несколько YAML-документов в один файл через '---'
+func fileWriteYAMLDocs(path string, docs ...interface{}) {
 	f, err := os.Create(path)
 	if err != nil {
 		fmt.Printf("%sError creating file %s: %v%s\n", colorRed, path, err, colorReset)
@@ -326,37 +666,48 @@ func fileWriteYAML(path string, data interface{}) {
 	defer f.Close()
 	enc := yaml.NewEncoder(f)
 	enc.SetIndent(2)
-	if err := enc.Encode(data); err != nil {
-		fmt.Printf("%sError writing YAML: %v%s\n", colorRed, err, colorReset)
-		os.Exit(1)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			fmt.Printf("%sError writing YAML: %v%s\n", colorRed, err, colorReset)
+			os.Exit(1)
+		}
 	}
 }
 
-// fileWriteYAMLWithHostname записывает YAML с дополнительным документом HostnameConfig (для Talos >= 1.12)
-func fileWriteYAMLWithHostname(path string, data interface{}, hostname string) {
-	f, err := os.Create(path)
-	if err != nil {
-		fmt.Printf("%sError creating file %s: %v%s\n", colorRed, path, err, colorReset)
-		os.Exit(1)
-	}
-	defer f.Close()
-
-	enc := yaml.NewEncoder(f)
+// yamlString сериализует данные в YAML с отступом 2, как файлы конфигурации
+func yamlString(data interface{}) string {
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
 	enc.SetIndent(2)
 	if err := enc.Encode(data); err != nil {
 		fmt.Printf("%sError writing YAML: %v%s\n", colorRed, err, colorReset)
 		os.Exit(1)
 	}
+	enc.Close()
+	return b.String()
+}
 
-	hostnameDoc := map[string]interface{}{
-		"apiVersion": "v1alpha1",
-		"kind":       "HostnameConfig",
-		"hostname":   hostname,
+// readYAMLDocs читает все YAML-документы из файла
+func readYAMLDocs(path string) ([]map[string]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
-	if err := enc.Encode(hostnameDoc); err != nil {
-		fmt.Printf("%sError writing HostnameConfig: %v%s\n", colorRed, err, colorReset)
-		os.Exit(1)
+	defer f.Close()
+	var docs []map[string]interface{}
+	dec := yaml.NewDecoder(f)
+	for {
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
 	}
+	return docs, nil
 }
 
 // removeInstallImageFromFile removes the `image:` line from the `install:` block in a YAML file.
@@ -463,12 +814,128 @@ func clearDir(dir string) error {
 	return nil
 }
 
+// kernelModules возвращает список модулей ядра для machine.kernel.modules.
+// Вызывается только при включенном DRBD, остальные модули добавляются к нему.
+func kernelModules(ans Answers) []map[string]interface{} {
+	mods := []map[string]interface{}{
+		{"name": "drbd", "parameters": []string{"usermode_helper=disabled"}},
+		{"name": "drbd_transport_tcp"},
+		{"name": "dm-thin-pool"},
+	}
+	if ans.UseZFS {
+		mods = append(mods, map[string]interface{}{"name": "zfs"})
+	}
+	if ans.UseSPL {
+		mods = append(mods, map[string]interface{}{"name": "spl"})
+	}
+	if ans.UseVFIOPCI {
+		mods = append(mods, map[string]interface{}{"name": "vfio_pci"})
+	}
+	if ans.UseVFIOIOMMU {
+		mods = append(mods, map[string]interface{}{"name": "vfio_iommu_type1"})
+	}
+	if ans.UseOVS {
+		mods = append(mods, map[string]interface{}{"name": "openvswitch"})
+	}
+	return mods
+}
+
 func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []string, isFromFile bool) {
 	configDir := configDir
 
-	// Определяем версию Talos для выбора формата hostname
+	if ans.Schematic != nil {
+		schematicImage, err := resolveSchematicImage(ans)
+		if err != nil {
+			fmt.Printf("%sError building schematic: %v%s\n", colorRed, err, colorReset)
+			os.Exit(1)
+		}
+		ans.Image = schematicImage
+	}
+
+	if err := validateAddressing(ans, cpIPs, workerIPs); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateEncryption(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateCPScheduling(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateLabels(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateInstallDisk(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	// Определяем версию Talos для выбора формата hostname и эмиттеров документов
 	talosVersion := extractTalosVersion(ans.Image)
+	if err := validateRoutes(ans, talosVersion); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateVLANs(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateLinks(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateVIP(ans, cpIPs); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateClusterNetwork(ans, cpIPs, workerIPs); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateKubelet(ans, cpIPs, workerIPs); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateControlPlane(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateOIDC(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateAudit(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateLogging(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateTalosAPIAccess(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateCloudProvider(ans); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+
 	useNewHostnameFormat := isTalos112OrNewer(talosVersion)
+	if err := validateEphemeral(ans, talosVersion); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateVolumes(ans, useNewHostnameFormat); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	if err := validateFeatures(ans, talosVersion); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
 
 	if err := checkTalosctlCompatibility(talosVersion); err != nil {
 		os.Exit(1)
@@ -480,7 +947,6 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 				"nameservers": []string{ans.DNS1, ans.DNS2},
 			},
 			"install": map[string]interface{}{
-				"disk":  ans.Disk,
 				"image": ans.Image,
 			},
 			"time": map[string]interface{}{
@@ -489,15 +955,21 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 		},
 		Cluster: map[string]interface{}{},
 	}
-	if ans.UseMirrors {
-		patch.Machine["registries"] = map[string]interface{}{
-			"mirrors": map[string]interface{}{
-				"docker.io": map[string]interface{}{
-					"endpoints": []string{"https://mirror.gcr.io", "https://dockerhub.timeweb.cloud"},
-				},
-			},
+	diskPerNode := installDiskPerNode(ans)
+	if !diskPerNode {
+		for k, v := range clusterInstallDisk(ans) {
+			patch.Machine["install"].(map[string]interface{})[k] = v
 		}
 	}
+	registryDocs := emittersFor(talosVersion).registries(patch.Machine, ans)
+	if ans.ImageCache != nil && ans.ImageCache.Enabled {
+		if imageCacheSupported(talosVersion) {
+			nestedMap(patch.Machine, "features", "imageCache")["localEnabled"] = true
+		} else {
+			fmt.Printf("%s⚠️  image cache requires Talos >= 1.10, imageCache is ignored%s\n", colorYellow, colorReset)
+		}
+	}
+	applyFeatures(ans, patch.Machine)
 	if ans.UseExtBalancer && ans.ExtBalancerIP != "" {
 		ips := strings.Split(ans.ExtBalancerIP, ",")
 		for i := range ips {
@@ -505,35 +977,28 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 		}
 		patch.Machine["certSANs"] = ips
 	}
-	if ans.UseDRBD && ans.WorkerCount == 0 {
-		mods := []map[string]interface{}{
-			{"name": "drbd", "parameters": []string{"usermode_helper=disabled"}},
-			{"name": "drbd_transport_tcp"},
-			{"name": "dm-thin-pool"},
-		}
-		if ans.UseZFS {
-			mods = append(mods, map[string]interface{}{"name": "zfs"})
-		}
-		if ans.UseSPL {
-			mods = append(mods, map[string]interface{}{"name": "spl"})
-		}
-		if ans.UseVFIOPCI {
-			mods = append(mods, map[string]interface{}{"name": "vfio_pci"})
-		}
-		if ans.UseVFIOIOMMU {
-			mods = append(mods, map[string]interface{}{"name": "vfio_iommu_type1"})
-		}
-		if ans.UseOVS {
-			mods = append(mods, map[string]interface{}{"name": "openvswitch"})
-		}
-		patch.Machine["kernel"] = map[string]interface{}{"modules": mods}
-	}
-	if ans.WorkerCount == 0 {
+	if cpSchedulingAllowed(ans) {
 		patch.Cluster["allowSchedulingOnControlPlanes"] = true
 	}
+	if len(ans.KubeletValidSubnets) > 0 {
+		nestedMap(patch.Machine, "kubelet", "nodeIP")["validSubnets"] = ans.KubeletValidSubnets
+	}
 	patch.Cluster["network"] = map[string]interface{}{
 		"cni": map[string]interface{}{"name": "none"},
 	}
+	if podSubnets, serviceSubnets := clusterSubnets(ans, cpIPs); len(podSubnets) > 0 || len(serviceSubnets) > 0 {
+		clusterNetwork := patch.Cluster["network"].(map[string]interface{})
+		if len(podSubnets) > 0 {
+			clusterNetwork["podSubnets"] = podSubnets
+		}
+		if len(serviceSubnets) > 0 {
+			clusterNetwork["serviceSubnets"] = serviceSubnets
+		}
+	}
+	podSubnets, _ := effectiveSubnets(ans, cpIPs)
+	for k, v := range controllerManagerCIDRArgs(ans, podSubnets) {
+		componentArgs(patch.Cluster, "controllerManager")[k] = v
+	}
 	patch.Cluster["proxy"] = map[string]interface{}{"disabled": true}
 
 	// Формируем SAN'ы для cluster.apiServer.certSANs
@@ -552,8 +1017,21 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 		}
 		patch.Cluster["apiServer"].(map[string]interface{})["certSANs"] = certSANs
 	}
+	applyOIDC(ans, patch.Cluster)
+	if err := applyAudit(ans, patch.Cluster); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	applyControlPlane(ans, patch.Cluster)
+	if err := applyCloudProvider(ans, patch); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
 
-	fileWriteYAML(filepath.Join(configDir, "patch.yaml"), patch)
+	// Документы RegistryMirrorConfig и KmsgLogConfig пишутся в patch.yaml после основного
+	patchDocs := append([]interface{}{patch}, registryDocs...)
+	patchDocs = append(patchDocs, applyLogging(ans, patch.Machine, talosVersion)...)
+	fileWriteYAMLDocs(filepath.Join(configDir, "patch.yaml"), patchDocs...)
 	fmt.Printf("%sCreated patch.yaml%s\n", colorGreen, colorReset)
 	fmt.Println("--------------------------------")
 
@@ -578,62 +1056,12 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 	}
 	for i, cpIP := range cpIPs {
 		filename := filepath.Join(configDir, fmt.Sprintf("cp%d.patch", i+1))
-		hostname := fmt.Sprintf("cp-%d", i+1)
-
-		var cpPatch map[string]interface{}
-		if useNewHostnameFormat {
-			// Talos >= 1.12: hostname в отдельном документе HostnameConfig
-			cpPatch = map[string]interface{}{
-				"machine": map[string]interface{}{
-					"network": map[string]interface{}{
-						"interfaces": []map[string]interface{}{
-							{
-								"interface": ans.Iface,
-								"dhcp":      false,
-								"addresses": []string{fmt.Sprintf("%s/%s", cpIP, ans.Netmask)},
-								"routes": []map[string]interface{}{
-									{"network": "0.0.0.0/0", "gateway": ans.Gateway},
-								},
-							},
-						},
-					},
-				},
-			}
-		} else {
-			// Talos < 1.12: hostname в machine.network.hostname
-			cpPatch = map[string]interface{}{
-				"machine": map[string]interface{}{
-					"network": map[string]interface{}{
-						"hostname": hostname,
-						"interfaces": []map[string]interface{}{
-							{
-								"interface": ans.Iface,
-								"dhcp":      false,
-								"addresses": []string{fmt.Sprintf("%s/%s", cpIP, ans.Netmask)},
-								"routes": []map[string]interface{}{
-									{"network": "0.0.0.0/0", "gateway": ans.Gateway},
-								},
-							},
-						},
-					},
-				},
-			}
-		}
-
-		if ans.UseVIP && ans.VIPIP != "" {
-			cpPatch["machine"].(map[string]interface{})["network"].(map[string]interface{})["interfaces"].([]map[string]interface{})[0]["vip"] = map[string]interface{}{"ip": ans.VIPIP}
-		}
-		if ans.UseMaxPods {
-			cpPatch["machine"].(map[string]interface{})["kubelet"] = map[string]interface{}{
-				"extraConfig": map[string]interface{}{"maxPods": 512},
-			}
-		}
-
-		if useNewHostnameFormat {
-			fileWriteYAMLWithHostname(filename, cpPatch, hostname)
-		} else {
-			fileWriteYAML(filename, cpPatch)
+		docs, err := nodePatchDocs(ans, newNodeSpec(ans, true, i, cpIP), talosVersion)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(1)
 		}
+		fileWriteYAMLDocs(filename, docs...)
 		fmt.Printf("%sCreated file: %s%s\n", colorGreen, filename, colorReset)
 	}
 	fmt.Println("--------------------------------")
@@ -659,77 +1087,17 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 	}
 	for i, workerIP := range workerIPs {
 		filename := filepath.Join(configDir, fmt.Sprintf("worker%d.patch", i+1))
-		hostname := fmt.Sprintf("worker-%d", i+1)
-
-		var workerPatch map[string]interface{}
-		if useNewHostnameFormat {
-			// Talos >= 1.12: hostname в отдельном документе HostnameConfig
-			workerPatch = map[string]interface{}{
-				"machine": map[string]interface{}{
-					"network": map[string]interface{}{
-						"interfaces": []map[string]interface{}{
-							{
-								"deviceSelector": map[string]interface{}{"physical": true},
-								"dhcp":           false,
-								"addresses":      []string{fmt.Sprintf("%s/%s", workerIP, ans.Netmask)},
-								"routes": []map[string]interface{}{
-									{"network": "0.0.0.0/0", "gateway": ans.Gateway},
-								},
-							},
-						},
-					},
-				},
-			}
-		} else {
-			// Talos < 1.12: hostname в machine.network.hostname
-			workerPatch = map[string]interface{}{
-				"machine": map[string]interface{}{
-					"network": map[string]interface{}{
-						"hostname": hostname,
-						"interfaces": []map[string]interface{}{
-							{
-								"deviceSelector": map[string]interface{}{"physical": true},
-								"dhcp":           false,
-								"addresses":      []string{fmt.Sprintf("%s/%s", workerIP, ans.Netmask)},
-								"routes": []map[string]interface{}{
-									{"network": "0.0.0.0/0", "gateway": ans.Gateway},
-								},
-							},
-						},
-					},
-				},
-			}
-		}
-
-		if ans.UseDRBD {
-			mods := []map[string]interface{}{
-				{"name": "drbd", "parameters": []string{"usermode_helper=disabled"}},
-				{"name": "drbd_transport_tcp"},
-				{"name": "dm-thin-pool"},
-			}
-			if ans.UseZFS {
-				mods = append(mods, map[string]interface{}{"name": "zfs"})
-			}
-			if ans.UseSPL {
-				mods = append(mods, map[string]interface{}{"name": "spl"})
-			}
-			if ans.UseVFIOPCI {
-				mods = append(mods, map[string]interface{}{"name": "vfio_pci"})
-			}
-			if ans.UseVFIOIOMMU {
-				mods = append(mods, map[string]interface{}{"name": "vfio_iommu_type1"})
-			}
-			if ans.UseOVS {
-				mods = append(mods, map[string]interface{}{"name": "openvswitch"})
-			}
-			workerPatch["machine"].(map[string]interface{})["kernel"] = map[string]interface{}{"modules": mods}
-		}
-
-		if useNewHostnameFormat {
-			fileWriteYAMLWithHostname(filename, workerPatch, hostname)
-		} else {
-			fileWriteYAML(filename, workerPatch)
+		docs, err := nodePatchDocs(ans, newNodeSpec(ans, false, i, workerIP), talosVersion)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(1)
 		}
+		fileWriteYAMLDocs(filename, docs...)
+		fmt.Printf("%sCreated file: %s%s\n", colorGreen, filename, colorReset)
+	}
+	if manifests := talosServiceAccountManifests(ans); len(manifests) > 0 {
+		filename := filepath.Join(configDir, talosAPIManifestsFile)
+		fileWriteYAMLDocs(filename, manifests...)
 		fmt.Printf("%sCreated file: %s%s\n", colorGreen, filename, colorReset)
 	}
 	fmt.Println("--------------------------------")
@@ -751,7 +1119,7 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 		fmt.Printf("%sError changing directory: %v%s\n", colorRed, err, colorReset)
 		os.Exit(1)
 	}
-	if err := runCmd("talosctl", "gen", "config", "--kubernetes-version", ans.K8sVersion, "--with-secrets", "secrets.yaml", ans.ClusterName, fmt.Sprintf("https://%s:6443", endpointIP), "--config-patch", "@patch.yaml"); err != nil {
+	if err := runCmd("talosctl", "gen", "config", "--kubernetes-version", ans.K8sVersion, "--with-secrets", "secrets.yaml", ans.ClusterName, kubeAPIURL(endpointIP), "--config-patch", "@patch.yaml"); err != nil {
 		fmt.Printf("%sError generating config: %v%s\n", colorRed, err, colorReset)
 		os.Exit(1)
 	}
@@ -800,13 +1168,16 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 	}
 	fmt.Println("--------------------------------")
 
-	endpoints := append([]string{}, cpIPs...)
+	var endpoints []string
+	for _, ip := range cpIPs {
+		endpoints = append(endpoints, talosconfigEndpoint(ip))
+	}
 	if ans.UseVIP && ans.VIPIP != "" {
-		endpoints = append(endpoints, ans.VIPIP)
+		endpoints = append(endpoints, talosconfigEndpoint(ans.VIPIP))
 	}
 	if ans.UseExtBalancer && ans.ExtBalancerIP != "" {
 		for _, ip := range strings.Split(ans.ExtBalancerIP, ",") {
-			endpoints = append(endpoints, strings.TrimSpace(ip))
+			endpoints = append(endpoints, talosconfigEndpoint(strings.TrimSpace(ip)))
 		}
 	}
 
@@ -835,42 +1206,13 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 	os.Chdir("..")
 	firstCP := cpIPs[0]
 	firstCPClean := strings.Split(firstCP, "/")[0]
+	// cluster.yaml нужен команде add в обоих режимах
+	input := inputFromAnswers(ans, cpIPs, workerIPs)
+	fileWriteYAML(filepath.Join(configDir, "cluster.yaml"), input)
 	if isFromFile {
 		fmt.Println("Cluster initialization skipped (non interactive mode)")
 		return
 	}
-	input := FileInput{
-		ClusterName:    ans.ClusterName,
-		K8sVersion:     ans.K8sVersion,
-		Image:          ans.Image,
-		DownloadImage:  ans.DownloadImage,
-		Iface:          ans.Iface,
-		CPCount:        ans.CPCount,
-		WorkerCount:    ans.WorkerCount,
-		Gateway:        ans.Gateway,
-		Netmask:        ans.Netmask,
-		DNS1:           ans.DNS1,
-		DNS2:           ans.DNS2,
-		NTP1:           ans.NTP1,
-		NTP2:           ans.NTP2,
-		NTP3:           ans.NTP3,
-		UseVIP:         ans.UseVIP,
-		VIPIP:          ans.VIPIP,
-		UseExtBalancer: ans.UseExtBalancer,
-		ExtBalancerIP:  ans.ExtBalancerIP,
-		Disk:           ans.Disk,
-		UseDRBD:        ans.UseDRBD,
-		UseZFS:         ans.UseZFS,
-		UseSPL:         ans.UseSPL,
-		UseVFIOPCI:     ans.UseVFIOPCI,
-		UseVFIOIOMMU:   ans.UseVFIOIOMMU,
-		UseOVS:         ans.UseOVS,
-		UseMirrors:     ans.UseMirrors,
-		UseMaxPods:     ans.UseMaxPods,
-		CPIPs:          cpIPs,
-		WorkerIPs:      workerIPs,
-	}
-	fileWriteYAML("cluster.yaml", input)
 
 	if !askYesNoNumbered("Do you want to start cluster initialization?", "y") {
 		fmt.Println("--------------------------------")
@@ -892,7 +1234,7 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 		fmt.Println("--------------------------------")
 		return
 	}
-	if err := runCmd("talosctl", "bootstrap", "--nodes", firstCPClean, "--endpoints", firstCPClean, "--talosconfig="+filepath.Join(configDir, "talosconfig")); err != nil {
+	if err := runCmd("talosctl", "bootstrap", "--nodes", firstCPClean, "--endpoints", talosEndpoint(firstCPClean), "--talosconfig="+filepath.Join(configDir, "talosconfig")); err != nil {
 		fmt.Printf("%sError bootstrap: %v%s\n", colorRed, err, colorReset)
 		printManualInitHelp(input, ans)
 		os.Exit(1)
@@ -935,14 +1277,26 @@ func runGeneration(ans Answers, usedIPs map[string]struct{}, cpIPs, workerIPs []
 		kubeconfigEndpoint = firstCPClean
 	}
 	kubeconfigPath := filepath.Join(os.Getenv("HOME"), ".kube", ans.ClusterName+".yaml")
-	if err := runCmd("talosctl", "kubeconfig", kubeconfigPath, "--nodes", kubeconfigEndpoint, "--endpoints", kubeconfigEndpoint, "--talosconfig", filepath.Join(configDir, "talosconfig")); err != nil {
+	if err := runCmd("talosctl", "kubeconfig", kubeconfigPath, "--nodes", kubeconfigEndpoint, "--endpoints", talosEndpoint(kubeconfigEndpoint), "--talosconfig", filepath.Join(configDir, "talosconfig")); err != nil {
 		fmt.Printf("%sError exporting kubeconfig: %v%s\n", colorRed, err, colorReset)
 		os.Exit(1)
 	}
+	if ans.OIDC != nil {
+		if err := addOIDCUser(kubeconfigPath, ans); err != nil {
+			fmt.Printf("%sError adding OIDC user to kubeconfig: %v%s\n", colorRed, err, colorReset)
+			os.Exit(1)
+		}
+		fmt.Printf("%sAdded context %s (kubectl oidc-login) to %s%s\n", colorGreen, oidcUserName(ans.ClusterName), kubeconfigPath, colorReset)
+	}
 	fmt.Println("--------------------------------")
 	fmt.Println("Script completed")
 	fmt.Println("--------------------------------")
-	fmt.Println("Next, you need to install the network plugin Cilium")
+	fmt.Println("Next, you need to install the network plugin Cilium:")
+	fmt.Println(ciliumInstallCommand(ans, kubeconfigEndpoint))
+	if len(talosServiceAccountManifests(ans)) > 0 {
+		fmt.Println("Then create Talos ServiceAccounts for in-cluster access to Talos API:")
+		fmt.Printf("kubectl --kubeconfig %s apply -f %s\n", kubeconfigPath, filepath.Join(configDir, talosAPIManifestsFile))
+	}
 	fmt.Println("Documentation: https://docs.cilium.io/en/stable/gettingstarted/k8s-install-default/")
 	fmt.Println("-----------done-----------------")
 }
@@ -965,7 +1319,7 @@ func printManualInitHelp(input FileInput, ans Answers) {
 	fmt.Println(colorRed + "Please, wait init and reboot first control plane, before run next commands" + colorReset)
 	b.WriteString("# Please, wait init and reboot first control plane, before run next commands\n")
 	fmt.Println("---------------")
-	cmd = fmt.Sprintf("talosctl bootstrap --nodes %s --endpoints %s --talosconfig=talosconfig", input.CPIPs[0], input.CPIPs[0])
+	cmd = fmt.Sprintf("talosctl bootstrap --nodes %s --endpoints %s --talosconfig=talosconfig", input.CPIPs[0], talosconfigEndpoint(input.CPIPs[0]))
 	fmt.Println(cmd)
 	b.WriteString(cmd + "\n")
 	fmt.Println("---------------")
@@ -982,11 +1336,25 @@ func printManualInitHelp(input FileInput, ans Answers) {
 		fmt.Println(cmd)
 		b.WriteString(cmd + "\n")
 	}
-	cmd = fmt.Sprintf("talosctl kubeconfig ~/.kube/%s.yaml --nodes %s --endpoints %s --talosconfig talosconfig", ans.ClusterName, endpoint, endpoint)
+	cmd = fmt.Sprintf("talosctl kubeconfig ~/.kube/%s.yaml --nodes %s --endpoints %s --talosconfig talosconfig", ans.ClusterName, endpoint, talosconfigEndpoint(endpoint))
 	fmt.Println(cmd)
 	b.WriteString(cmd + "\n")
+	if ans.OIDC != nil {
+		for _, cmd := range oidcKubectlCommands(ans) {
+			fmt.Println(cmd)
+			b.WriteString(cmd + "\n")
+		}
+	}
+	cmd = ciliumInstallCommand(ans, endpoint)
+	fmt.Println(cmd)
+	b.WriteString(cmd + "\n")
+	if len(talosServiceAccountManifests(ans)) > 0 {
+		cmd = fmt.Sprintf("kubectl --kubeconfig ~/.kube/%s.yaml apply -f %s", ans.ClusterName, talosAPIManifestsFile)
+		fmt.Println(cmd)
+		b.WriteString(cmd + "\n")
+	}
 	b.WriteString("````\n")
-	fmt.Println("-----------------------------\n")
+	fmt.Print("-----------------------------\n\n")
 	// save to commands.md
 	cmdPath := "commands.md"
 	f, err := os.Create(cmdPath)
@@ -1047,47 +1415,13 @@ func generateCmd() *cobra.Command {
 			}
 
 			if fromFile != "" {
-				var input FileInput
-				f, err := os.Open(fromFile)
+				input, err := readFileInput(fromFile)
 				if err != nil {
-					fmt.Printf("%sFailed to open file: %v%s\n", colorRed, err, colorReset)
+					fmt.Printf("%s%v%s\n", colorRed, err, colorReset)
 					os.Exit(1)
 				}
-				defer f.Close()
-				dec := yaml.NewDecoder(f)
-				if err := dec.Decode(&input); err != nil {
-					fmt.Printf("%sFailed to parse YAML: %v%s\n", colorRed, err, colorReset)
-					os.Exit(1)
-				}
-				ans := Answers{
-					ClusterName:    input.ClusterName,
-					K8sVersion:     input.K8sVersion,
-					Image:          input.Image,
-					DownloadImage:  input.DownloadImage,
-					Iface:          input.Iface,
-					CPCount:        input.CPCount,
-					WorkerCount:    input.WorkerCount,
-					Gateway:        input.Gateway,
-					Netmask:        input.Netmask,
-					DNS1:           input.DNS1,
-					DNS2:           input.DNS2,
-					NTP1:           input.NTP1,
-					NTP2:           input.NTP2,
-					NTP3:           input.NTP3,
-					UseVIP:         input.UseVIP,
-					VIPIP:          input.VIPIP,
-					UseExtBalancer: input.UseExtBalancer,
-					ExtBalancerIP:  input.ExtBalancerIP,
-					Disk:           input.Disk,
-					UseDRBD:        input.UseDRBD,
-					UseZFS:         input.UseZFS,
-					UseSPL:         input.UseSPL,
-					UseVFIOPCI:     input.UseVFIOPCI,
-					UseVFIOIOMMU:   input.UseVFIOIOMMU,
-					UseOVS:         input.UseOVS,
-					UseMirrors:     input.UseMirrors,
-					UseMaxPods:     input.UseMaxPods,
-				}
+				ans := answersFromInput(input)
+
 				usedIPs := map[string]struct{}{input.Gateway: {}}
 				for _, ip := range input.CPIPs {
 					usedIPs[ip] = struct{}{}
@@ -1095,6 +1429,16 @@ func generateCmd() *cobra.Command {
 				for _, ip := range input.WorkerIPs {
 					usedIPs[ip] = struct{}{}
 				}
+				if input.DiscoverSubnet != "" && (len(input.CPIPs) < input.CPCount || len(input.WorkerIPs) < input.WorkerCount) {
+					fmt.Printf("Discovering nodes in %s ..\n", input.DiscoverSubnet)
+					discovered, err := discoverNodes(input.DiscoverSubnet, defaultDialTimeout)
+					if err != nil {
+						fmt.Printf("%sError discovering nodes: %v%s\n", colorRed, err, colorReset)
+						os.Exit(1)
+					}
+					input.CPIPs, input.WorkerIPs = fillDiscoveredIPs(ans, input.CPIPs, input.WorkerIPs, discovered, usedIPs)
+					fmt.Printf("%sDiscovered control planes: %v, workers: %v%s\n", colorGreen, input.CPIPs, input.WorkerIPs, colorReset)
+				}
 				runGeneration(ans, usedIPs, input.CPIPs, input.WorkerIPs, true)
 				printManualInitHelp(input, ans)
 				return
@@ -1105,7 +1449,25 @@ func generateCmd() *cobra.Command {
 			ans.K8sVersion = askNumbered("Enter Kubernetes version ["+k8sVersion+"]: ", k8sVersion)
 			ans.Image = askNumbered("Enter Talos installer image ["+image+"]: ", image)
 			ans.DownloadImage = askYesNoNumbered("Download installer image from external registry? (No keeps the currently booted image)", "n")
-			ans.Iface = askNumbered("Enter network interface name: ens18 for KVM, Proxmox or eth0 for Nebula, OpenStack [ens18]: ", "ens18")
+			var nicMode string
+			for {
+				nicMode = askNumbered("How to select the network interface (name/mac/driver/busPath/physical) [name]: ", "name")
+				if nicMode == "name" || nicMode == "mac" || nicMode == "driver" || nicMode == "busPath" || nicMode == "physical" {
+					break
+				}
+				fmt.Printf("%sEnter one of: name, mac, driver, busPath, physical.%s\n", colorRed, colorReset)
+			}
+			switch nicMode {
+			case "name":
+				ans.Iface = askNumbered("Enter network interface name: ens18 for KVM, Proxmox or eth0 for Nebula, OpenStack [ens18]: ", "ens18")
+			case "driver":
+				ans.NIC = &NICSelector{DeviceSelector: DeviceSelector{Driver: askNumbered("Enter network driver (e.g. virtio_net, ixgbe, mlx5_core): ", "")}}
+			case "busPath":
+				ans.NIC = &NICSelector{DeviceSelector: DeviceSelector{BusPath: askNumbered("Enter PCI bus path (e.g. 0000:00:03.0): ", "")}}
+			case "physical":
+				physical := true
+				ans.NIC = &NICSelector{DeviceSelector: DeviceSelector{Physical: &physical}}
+			}
 			var cpCount int
 			for {
 				cpCount = mustAtoi(askNumbered("Enter number of control planes (odd, max 7) [1]: ", "1"))
@@ -1117,8 +1479,17 @@ func generateCmd() *cobra.Command {
 			}
 			ans.CPCount = cpCount
 			ans.WorkerCount = mustAtoi(askNumbered("Enter number of worker nodes (max 15, min 0) [3]: ", "3"))
-			ans.Gateway = askNumbered("Enter default gateway: ", "")
-			ans.Netmask = askNumbered("Enter network mask [24]: ", "24")
+			for {
+				ans.Addressing = strings.ToLower(askNumbered("Enter addressing mode (static/dhcp) [static]: ", addressingStatic))
+				if ans.Addressing == addressingStatic || ans.Addressing == addressingDHCP {
+					break
+				}
+				fmt.Printf("%sEnter 'static' or 'dhcp'.%s\n", colorRed, colorReset)
+			}
+			if ans.Addressing == addressingStatic {
+				ans.Gateway = askNumbered("Enter default gateway: ", "")
+				ans.Netmask = askNumbered("Enter network mask [24]: ", "24")
+			}
 			ans.DNS1 = askNumbered("Enter first DNS server [8.8.8.8]: ", "8.8.8.8")
 			ans.DNS2 = askNumbered("Enter second DNS server [8.8.4.4]: ", "8.8.4.4")
 			ans.NTP1 = askNumbered("Enter first NTP server [1.ru.pool.ntp.org]: ", "1.ru.pool.ntp.org")
@@ -1146,12 +1517,37 @@ func generateCmd() *cobra.Command {
 			ans.UseOVS = askYesNoNumbered("Enable openvswitch support?", "n")
 			ans.UseMirrors = askYesNoNumbered("Use timeweb.cloud and gcr.io mirrors for docker.io?", "y")
 			ans.UseMaxPods = askYesNoNumbered("Set maxPods: 512 for kubelet? (default is 110 per node)", "n")
+			ans.Features = askFeatures(extractTalosVersion(ans.Image))
 			usedIPs := map[string]struct{}{ans.Gateway: {}}
+			var discovered []string
+			if ans.Addressing == addressingDHCP {
+				if askYesNoNumbered("Discover nodes in maintenance mode by subnet scan?", "y") {
+					ans.DiscoverSubnet = askNumbered("Enter subnet to scan (e.g. 192.168.1.0/24): ", "")
+					nodes, err := discoverNodes(ans.DiscoverSubnet, defaultDialTimeout)
+					if err != nil {
+						fmt.Printf("%sError discovering nodes: %v%s\n", colorRed, err, colorReset)
+					} else {
+						fmt.Printf("%sFound nodes: %v%s\n", colorGreen, nodes, colorReset)
+						discovered = nodes
+					}
+				}
+			}
+			nextDiscovered := func() string {
+				for len(discovered) > 0 {
+					ip := discovered[0]
+					discovered = discovered[1:]
+					if _, ok := usedIPs[ip]; !ok {
+						return ip
+					}
+				}
+				return ""
+			}
 			var cpIPs, workerIPs []string
 			for i := 1; i <= ans.CPCount; i++ {
 				var cpIP string
 				for {
-					cpIP = askNumbered(fmt.Sprintf("Enter IP address for control plane %d: ", i), "")
+					def := nextDiscovered()
+					cpIP = askNumbered(ipPrompt(fmt.Sprintf("Enter IP address for control plane %d", i), def), def)
 					if cpIP == "" {
 						fmt.Printf("%sIP address cannot be empty.%s\n", colorRed, colorReset)
 						continue
@@ -1164,12 +1560,16 @@ func generateCmd() *cobra.Command {
 					break
 				}
 				cpIPs = append(cpIPs, cpIP)
+				if nicMode == "mac" {
+					askNodeMAC(&ans, fmt.Sprintf("cp-%d", i), cpIP)
+				}
 			}
 			if ans.WorkerCount > 0 {
 				for i := 1; i <= ans.WorkerCount; i++ {
 					var workerIP string
 					for {
-						workerIP = askNumbered(fmt.Sprintf("Enter IP address for worker %d: ", i), "")
+						def := nextDiscovered()
+						workerIP = askNumbered(ipPrompt(fmt.Sprintf("Enter IP address for worker %d", i), def), def)
 						if workerIP == "" {
 							fmt.Printf("%sIP address cannot be empty.%s\n", colorRed, colorReset)
 							continue
@@ -1182,6 +1582,9 @@ func generateCmd() *cobra.Command {
 						break
 					}
 					workerIPs = append(workerIPs, workerIP)
+					if nicMode == "mac" {
+						askNodeMAC(&ans, fmt.Sprintf("worker-%d", i), workerIP)
+					}
 				}
 			}
 			runGeneration(ans, usedIPs, cpIPs, workerIPs, false)
@@ -1192,16 +1595,66 @@ func generateCmd() *cobra.Command {
 	return cmd
 }
 
+// addNodeOptions — параметры новой ноды из флагов команды add
+type addNodeOptions struct {
+	IsCP          bool
+	Num           int
+	Address       string
+	Address6      string
+	MAC           string
+	VLANAddresses []string
+}
+
+// addAnswersFile ищет cluster.yaml для команды add: --from-file, каталог конфигурации
+// или текущий каталог (туда cluster.yaml писали версии до v1.5.0)
+func addAnswersFile(configDir, fromFile string) (string, error) {
+	if fromFile != "" {
+		return fromFile, nil
+	}
+	for _, path := range []string{filepath.Join(configDir, "cluster.yaml"), "cluster.yaml"} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("cluster.yaml not found in %s or the current directory, pass the answers file the cluster was generated from with --from-file", configDir)
+}
+
+// addedNodeDocs собирает патч ноды для команды add из cluster.yaml так же, как generate
+func addedNodeDocs(answersFile string, opts addNodeOptions, talosVersion string) ([]interface{}, error) {
+	input, err := readFileInput(answersFile)
+	if err != nil {
+		return nil, err
+	}
+	ans := answersFromInput(input)
+	if talosVersion == "" {
+		talosVersion = extractTalosVersion(ans.Image)
+	}
+	spec := newNodeSpec(ans, opts.IsCP, opts.Num-1, opts.Address)
+	spec.IP6 = opts.Address6
+	ans, err = addedNodeAnswers(ans, spec, opts.MAC, opts.VLANAddresses)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateLinks(ans); err != nil {
+		return nil, err
+	}
+	return nodePatchDocs(ans, spec, talosVersion)
+}
+
 func addCmd() *cobra.Command {
 	var cpNum int
 	var workerNum int
 	var address string
+	var address6 string
+	var vlanAddresses []string
+	var mac string
+	var fromFile string
 	var autoApply bool
 
 	cmd := &cobra.Command{
 		Use:   "add",
 		Short: "Add new node based on existing configuration",
-		Long:  `Add new node configuration based on existing cp1.patch or worker1.patch`,
+		Long:  `Add new node configuration: the node patch is built from cluster.yaml (cluster, group and node sections) and applied to controlplane.yaml or worker.yaml`,
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := checkRequiredTools(); err != nil {
 				os.Exit(1)
@@ -1228,7 +1681,6 @@ func addCmd() *cobra.Command {
 
 			var nodeType string
 			var nodeNum int
-			var basePatchFile string
 			var baseYamlFile string
 			var newPatchFile string
 			var newYamlFile string
@@ -1236,14 +1688,12 @@ func addCmd() *cobra.Command {
 			if cpNum > 0 {
 				nodeType = "cp"
 				nodeNum = cpNum
-				basePatchFile = filepath.Join(configDir, "cp1.patch")
 				baseYamlFile = filepath.Join(configDir, "controlplane.yaml")
 				newPatchFile = filepath.Join(configDir, fmt.Sprintf("cp%d.patch", nodeNum))
 				newYamlFile = filepath.Join(configDir, fmt.Sprintf("cp%d.yaml", nodeNum))
 			} else {
 				nodeType = "worker"
 				nodeNum = workerNum
-				basePatchFile = filepath.Join(configDir, "worker1.patch")
 				baseYamlFile = filepath.Join(configDir, "worker.yaml")
 				newPatchFile = filepath.Join(configDir, fmt.Sprintf("worker%d.patch", nodeNum))
 				newYamlFile = filepath.Join(configDir, fmt.Sprintf("worker%d.yaml", nodeNum))
@@ -1261,11 +1711,6 @@ func addCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
-			if _, err := os.Stat(basePatchFile); os.IsNotExist(err) {
-				fmt.Printf("%sError: base patch file %s does not exist%s\n", colorRed, basePatchFile, colorReset)
-				os.Exit(1)
-			}
-
 			if _, err := os.Stat(newPatchFile); err == nil {
 				fmt.Printf("%sError: patch file %s already exists%s\n", colorRed, newPatchFile, colorReset)
 				os.Exit(1)
@@ -1278,7 +1723,6 @@ func addCmd() *cobra.Command {
 
 			// Определяем версию Talos из patch.yaml
 			patchYamlFile := filepath.Join(configDir, "patch.yaml")
-			var useNewHostnameFormat bool
 			var detectedTalosVersion string
 			if pf, err := os.Open(patchYamlFile); err == nil {
 				var patchYamlData map[string]interface{}
@@ -1288,7 +1732,6 @@ func addCmd() *cobra.Command {
 						if install, ok := machine["install"].(map[string]interface{}); ok {
 							if img, ok := install["image"].(string); ok {
 								detectedTalosVersion = extractTalosVersion(img)
-								useNewHostnameFormat = isTalos112OrNewer(detectedTalosVersion)
 							}
 						}
 					}
@@ -1300,84 +1743,24 @@ func addCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
-			f, err := os.Open(basePatchFile)
+			answersFile, err := addAnswersFile(configDir, fromFile)
 			if err != nil {
-				fmt.Printf("%sError reading base patch file: %v%s\n", colorRed, err, colorReset)
-				os.Exit(1)
-			}
-			defer f.Close()
-
-			var patchData map[string]interface{}
-			dec := yaml.NewDecoder(f)
-			if err := dec.Decode(&patchData); err != nil {
-				fmt.Printf("%sError parsing base patch file: %v%s\n", colorRed, err, colorReset)
+				fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
 				os.Exit(1)
 			}
-
-			machine, ok := patchData["machine"].(map[string]interface{})
-			if !ok {
-				fmt.Printf("%sError: invalid patch structure%s\n", colorRed, colorReset)
-				os.Exit(1)
-			}
-
-			network, ok := machine["network"].(map[string]interface{})
-			if !ok {
-				fmt.Printf("%sError: invalid patch structure%s\n", colorRed, colorReset)
-				os.Exit(1)
-			}
-
-			interfaces, ok := network["interfaces"].([]interface{})
-			if !ok || len(interfaces) == 0 {
-				fmt.Printf("%sError: invalid patch structure%s\n", colorRed, colorReset)
-				os.Exit(1)
-			}
-
-			interfaceMap, ok := interfaces[0].(map[string]interface{})
-			if !ok {
-				fmt.Printf("%sError: invalid patch structure%s\n", colorRed, colorReset)
-				os.Exit(1)
-			}
-
-			addresses, ok := interfaceMap["addresses"].([]interface{})
-			if !ok || len(addresses) == 0 {
-				fmt.Printf("%sError: invalid patch structure%s\n", colorRed, colorReset)
-				os.Exit(1)
-			}
-
-			oldAddress, ok := addresses[0].(string)
-			if !ok {
-				fmt.Printf("%sError: invalid patch structure%s\n", colorRed, colorReset)
-				os.Exit(1)
-			}
-
-			parts := strings.Split(oldAddress, "/")
-			if len(parts) != 2 {
-				fmt.Printf("%sError: invalid address format in base patch%s\n", colorRed, colorReset)
+			docs, err := addedNodeDocs(answersFile, addNodeOptions{
+				IsCP:          nodeType == "cp",
+				Num:           nodeNum,
+				Address:       address,
+				Address6:      address6,
+				MAC:           mac,
+				VLANAddresses: vlanAddresses,
+			}, detectedTalosVersion)
+			if err != nil {
+				fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
 				os.Exit(1)
 			}
-
-			netmask := parts[1]
-			newAddressWithMask := fmt.Sprintf("%s/%s", address, netmask)
-
-			addresses[0] = newAddressWithMask
-			interfaceMap["addresses"] = addresses
-
-			var hostname string
-			if nodeType == "cp" {
-				hostname = fmt.Sprintf("cp-%d", nodeNum)
-			} else {
-				hostname = fmt.Sprintf("worker-%d", nodeNum)
-			}
-
-			if useNewHostnameFormat {
-				// Talos >= 1.12: hostname в отдельном документе, удаляем из network если был
-				delete(network, "hostname")
-				fileWriteYAMLWithHostname(newPatchFile, patchData, hostname)
-			} else {
-				// Talos < 1.12: hostname в machine.network.hostname
-				network["hostname"] = hostname
-				fileWriteYAML(newPatchFile, patchData)
-			}
+			fileWriteYAMLDocs(newPatchFile, docs...)
 			fmt.Printf("%sCreated patch file: %s%s\n", colorGreen, newPatchFile, colorReset)
 
 			if err := os.Chdir(configDir); err != nil {
@@ -1422,6 +1805,10 @@ func addCmd() *cobra.Command {
 	cmd.Flags().IntVar(&cpNum, "cp", 0, "Control plane node number")
 	cmd.Flags().IntVar(&workerNum, "worker", 0, "Worker node number")
 	cmd.Flags().StringVar(&address, "address", "", "IP address for the new node")
+	cmd.Flags().StringVar(&address6, "address6", "", "IPv6 address for the new node (dual-stack clusters)")
+	cmd.Flags().StringVar(&mac, "mac", "", "MAC address of the network interface for the new node (when nodes select NIC by hardwareAddr)")
+	cmd.Flags().StringArrayVar(&vlanAddresses, "vlan-address", nil, "VLAN address for the new node as <vlanId>=<ip> (repeat for each VLAN)")
+	cmd.Flags().StringVar(&fromFile, "from-file", "", "Cluster answers file used to build the node patch (default <config-dir>/cluster.yaml)")
 	cmd.Flags().BoolVar(&autoApply, "auto-apply", false, "Automatically apply configuration to the node")
 	return cmd
 }
@@ -1443,6 +1830,9 @@ func main() {
 	rootCmd.SetVersionTemplate("talostpl version {{.Version}}\n")
 	rootCmd.AddCommand(generateCmd())
 	rootCmd.AddCommand(addCmd())
+	rootCmd.AddCommand(imageCmd())
+	rootCmd.AddCommand(discoverCmd())
+	rootCmd.AddCommand(migrateCmd())
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
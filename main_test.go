@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddAnswersFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := addAnswersFile(dir, ""); err == nil || !strings.Contains(err.Error(), "--from-file") {
+		t.Errorf("expected error pointing to --from-file, got %v", err)
+	}
+	if path, err := addAnswersFile(dir, "other.yaml"); err != nil || path != "other.yaml" {
+		t.Errorf("addAnswersFile with --from-file = %q, %v", path, err)
+	}
+	clusterFile := filepath.Join(dir, "cluster.yaml")
+	if err := os.WriteFile(clusterFile, []byte("clusterName: t\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if path, err := addAnswersFile(dir, ""); err != nil || path != clusterFile {
+		t.Errorf("addAnswersFile = %q, %v, want %s", path, err, clusterFile)
+	}
+}
+
+func TestAddedNodeDocs(t *testing.T) {
+	const cluster = `clusterName: t
+image: factory.talos.dev/nocloud-installer/x:v1.11.5
+iface: eth0
+cpCount: 1
+workerCount: 1
+gateway: 10.0.0.1
+netmask: 24
+cpIPs: [10.0.0.11]
+workerIPs: [10.0.0.21]
+groups:
+  worker:
+    labels:
+      role: storage
+nodes:
+  worker-1:
+    labels:
+      only: first
+    maxPods: 200
+  worker-2:
+    maxPods: 150
+`
+	answersFile := filepath.Join(t.TempDir(), "cluster.yaml")
+	if err := os.WriteFile(answersFile, []byte(cluster), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := addedNodeDocs(answersFile, addNodeOptions{Num: 2, Address: "10.0.0.22"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := renderDocs(t, docs)
+	want := `machine:
+  kubelet:
+    extraConfig:
+      maxPods: 150
+  network:
+    hostname: worker-2
+    interfaces:
+      - addresses:
+          - 10.0.0.22/24
+        deviceSelector:
+          physical: true
+        dhcp: false
+        routes:
+          - gateway: 10.0.0.1
+            network: 0.0.0.0/0
+  nodeLabels:
+    role: storage
+`
+	if got != want {
+		t.Errorf("unexpected patch:\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+
+	if _, err := addedNodeDocs(filepath.Join(t.TempDir(), "missing.yaml"), addNodeOptions{Num: 2, Address: "10.0.0.22"}, ""); err == nil {
+		t.Errorf("expected error for missing answers file")
+	}
+}
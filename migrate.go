@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// migrateTargets — версии Talos, на которые умеет переводить migrate
+var migrateTargets = map[string]bool{"1.12": true}
+
+// nodeFileRe — патчи и готовые конфиги нод: cp1.patch, worker2.yaml
+var nodeFileRe = regexp.MustCompile(`^(cp|worker)\d+\.(patch|yaml)$`)
+
+// fileChange — новое содержимое файла в config dir
+type fileChange struct {
+	path     string
+	old, new string
+	notes    []string
+}
+
+func migrateCmd() *cobra.Command {
+	var to string
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate patches and configs to a newer Talos document layout",
+		Long: `Rewrite node patches and rendered configs in the config dir for a newer Talos version:
+machine.network.hostname becomes a HostnameConfig document, machine.systemDiskEncryption becomes VolumeConfig documents,
+and the installer image in patch.yaml and configs is updated. Shows a diff before writing.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			to = strings.TrimPrefix(to, "v")
+			if !migrateTargets[to] {
+				fmt.Printf("%sError: unsupported --to=%s (supported: 1.12)%s\n", colorRed, to, colorReset)
+				os.Exit(1)
+			}
+
+			patchYamlFile := filepath.Join(configDir, "patch.yaml")
+			docs, err := readYAMLNodes(patchYamlFile)
+			if err != nil || len(docs) == 0 {
+				fmt.Printf("%sError reading %s: %v%s\n", colorRed, patchYamlFile, err, colorReset)
+				os.Exit(1)
+			}
+			oldImage := ""
+			if n := yamlPath(docs[0], "machine", "install", "image"); n != nil {
+				oldImage = n.Value
+			}
+			newImage, err := migrateImage(oldImage, to, cmd.Flag("image").Changed)
+			if err != nil {
+				fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+				os.Exit(1)
+			}
+			if err := checkTalosctlCompatibility(extractTalosVersion(newImage)); err != nil {
+				os.Exit(1)
+			}
+
+			changes, err := migrateConfigDir(configDir, oldImage, newImage)
+			if err != nil {
+				fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+				os.Exit(1)
+			}
+			if len(changes) == 0 {
+				fmt.Printf("%sNothing to migrate in %s%s\n", colorGreen, configDir, colorReset)
+				return
+			}
+
+			for _, c := range changes {
+				fmt.Printf("%s=== %s%s\n", colorYellow, c.path, colorReset)
+				for _, note := range c.notes {
+					fmt.Printf("%s⚠️  %s%s\n", colorYellow, note, colorReset)
+				}
+				printDiff(c.old, c.new)
+			}
+			fmt.Println("--------------------------------")
+
+			if !yes && !askYesNoNumbered(fmt.Sprintf("Write changes to %d file(s)?", len(changes)), "n") {
+				fmt.Printf("%sMigration cancelled, no files changed.%s\n", colorYellow, colorReset)
+				return
+			}
+			for _, c := range changes {
+				if err := os.WriteFile(c.path, []byte(c.new), 0644); err != nil {
+					fmt.Printf("%sError writing %s: %v%s\n", colorRed, c.path, err, colorReset)
+					os.Exit(1)
+				}
+				fmt.Printf("%sUpdated file: %s%s\n", colorGreen, c.path, colorReset)
+			}
+			fmt.Printf("%sApply updated configs with talosctl apply-config and upgrade nodes to %s%s\n", colorYellow, newImage, colorReset)
+		},
+	}
+
+	cmd.Flags().StringVar(&to, "to", "", "Target Talos version (1.12)")
+	cmd.Flags().BoolVar(&yes, "yes", false, "Write changes without confirmation")
+	cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+// migrateImage возвращает образ для целевой версии: --image, если задан явно,
+// иначе текущий образ (тот же schematic) с тегом версии по умолчанию.
+func migrateImage(oldImage, to string, imageFlagSet bool) (string, error) {
+	if imageFlagSet {
+		if !strings.HasPrefix(extractTalosVersion(image), to+".") {
+			return "", fmt.Errorf("--image %s is not Talos %s", image, to)
+		}
+		return image, nil
+	}
+	if strings.HasPrefix(extractTalosVersion(oldImage), to+".") {
+		return oldImage, nil
+	}
+	defaultVersion := extractTalosVersion(image)
+	if oldImage == "" || !strings.HasPrefix(defaultVersion, to+".") {
+		return "", fmt.Errorf("cannot choose installer image for Talos %s, set --image", to)
+	}
+	repo := oldImage[:strings.LastIndex(oldImage, ":")]
+	return repo + ":v" + defaultVersion, nil
+}
+
+// migrateConfigDir готовит изменения всех файлов config dir без записи на диск
+func migrateConfigDir(dir, oldImage, newImage string) ([]fileChange, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var changes []fileChange
+	for _, name := range names {
+		isNode := nodeFileRe.MatchString(name)
+		isBase := name == "patch.yaml" || name == "controlplane.yaml" || name == "worker.yaml" || name == "cluster.yaml"
+		if !isNode && !isBase {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		docs, err := decodeYAMLNodes(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if len(docs) == 0 {
+			continue
+		}
+
+		var notes []string
+		if name == "cluster.yaml" {
+			if n := yamlPath(docs[0], "image"); n != nil && n.Value == oldImage {
+				n.Value = newImage
+			}
+		} else {
+			if n := yamlPath(docs[0], "machine", "install", "image"); n != nil && n.Value == oldImage {
+				n.Value = newImage
+			}
+		}
+		if isNode {
+			docs, notes, err = migrateNodeDocs(docs)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+
+		out, err := encodeYAMLNodes(docs, yamlIndent(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if out != string(data) && !sameYAML(string(data), out) {
+			changes = append(changes, fileChange{path: path, old: string(data), new: out, notes: notes})
+		}
+	}
+	return changes, nil
+}
+
+// migrateNodeDocs переносит hostname и шифрование ноды в отдельные документы (Talos >= 1.12).
+// hostname ноды сохраняется, machine.disks остается как есть: перенос разделов на другие тома небезопасен.
+func migrateNodeDocs(docs []*yaml.Node) ([]*yaml.Node, []string, error) {
+	var notes []string
+	base := docs[0]
+	var extra []*yaml.Node
+
+	if network := yamlPath(base, "machine", "network"); network != nil {
+		if hostname := yamlRemoveKey(network, "hostname"); hostname != nil {
+			for _, doc := range docs[1:] {
+				if yamlKind(doc) == "HostnameConfig" {
+					return nil, nil, fmt.Errorf("both machine.network.hostname and HostnameConfig are set")
+				}
+			}
+			doc, err := yamlDocument(map[string]interface{}{
+				"apiVersion": "v1alpha1",
+				"kind":       "HostnameConfig",
+				"hostname":   hostname.Value,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			extra = append(extra, doc)
+		}
+	}
+
+	rest := docs[1:]
+	if machine := yamlPath(base, "machine"); machine != nil {
+		if enc := yamlRemoveKey(machine, "systemDiskEncryption"); enc != nil {
+			var legacy map[string]interface{}
+			if err := enc.Decode(&legacy); err != nil {
+				return nil, nil, err
+			}
+			for _, vol := range []string{volumeState, volumeEphemeral} {
+				spec, ok := legacy[strings.ToLower(vol)]
+				if !ok {
+					continue
+				}
+				specNode := &yaml.Node{}
+				if err := specNode.Encode(spec); err != nil {
+					return nil, nil, err
+				}
+				if existing := yamlFindVolumeConfig(rest, vol); existing != nil {
+					yamlSetKey(existing.Content[0], "encryption", specNode)
+					continue
+				}
+				doc, err := yamlDocument(map[string]interface{}{
+					"apiVersion": "v1alpha1",
+					"kind":       "VolumeConfig",
+					"name":       vol,
+					"encryption": spec,
+				})
+				if err != nil {
+					return nil, nil, err
+				}
+				extra = append(extra, doc)
+			}
+		}
+		if yamlPath(machine, "disks") != nil {
+			notes = append(notes, "machine.disks is kept as is, move it to volumes manually when the disks are empty")
+		}
+	}
+
+	result := append([]*yaml.Node{base}, extra...)
+	return append(result, rest...), notes, nil
+}
+
+// readYAMLNodes читает все YAML-документы файла как yaml.Node (сохраняя порядок ключей и комментарии)
+func readYAMLNodes(path string) ([]*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeYAMLNodes(data)
+}
+
+func decodeYAMLNodes(data []byte) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+			docs = append(docs, &doc)
+		}
+	}
+	return docs, nil
+}
+
+func encodeYAMLNodes(docs []*yaml.Node, indent int) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indent)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return "", err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// yamlIndent определяет отступ файла: патчи talostpl пишутся с 2 пробелами, talosctl — с 4
+func yamlIndent(data []byte) int {
+	for _, l := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(l, " ")
+		if trimmed == "" || trimmed == l || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if len(l)-len(trimmed) >= 4 {
+			return 4
+		}
+		return 2
+	}
+	return 2
+}
+
+// sameYAML сравнивает файлы без учета форматирования, чтобы не переписывать файлы только ради отступов
+func sameYAML(a, b string) bool {
+	da, err := decodeYAMLNodes([]byte(a))
+	if err != nil {
+		return false
+	}
+	ea, err := encodeYAMLNodes(da, yamlIndent([]byte(a)))
+	return err == nil && ea == b
+}
+
+// yamlDocument создает документ из значения
+func yamlDocument(v interface{}) (*yaml.Node, error) {
+	n := &yaml.Node{}
+	if err := n.Encode(v); err != nil {
+		return nil, err
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{n}}, nil
+}
+
+// yamlPath возвращает значение по пути ключей от документа или mapping-узла
+func yamlPath(n *yaml.Node, keys ...string) *yaml.Node {
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	for _, key := range keys {
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				next = n.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		n = next
+	}
+	return n
+}
+
+// yamlRemoveKey удаляет ключ из mapping-узла и возвращает его значение
+func yamlRemoveKey(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			value := n.Content[i+1]
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return value
+		}
+	}
+	return nil
+}
+
+// yamlSetKey задает значение ключа mapping-узла, добавляя ключ в конец при отсутствии
+func yamlSetKey(n *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = value
+			return
+		}
+	}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func yamlKind(doc *yaml.Node) string {
+	if n := yamlPath(doc, "kind"); n != nil {
+		return n.Value
+	}
+	return ""
+}
+
+func yamlFindVolumeConfig(docs []*yaml.Node, name string) *yaml.Node {
+	for _, doc := range docs {
+		if n := yamlPath(doc, "name"); yamlKind(doc) == "VolumeConfig" && n != nil && n.Value == name {
+			return doc
+		}
+	}
+	return nil
+}
+
+// printDiff выводит построчный diff (LCS) с тремя строками контекста
+func printDiff(a, b string) {
+	al := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	bl := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+	// lcs[i][j] — длина общей подпоследовательности al[i:] и bl[j:]
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(al) || j < len(bl) {
+		switch {
+		case i < len(al) && j < len(bl) && al[i] == bl[j]:
+			lines = append(lines, line{' ', al[i]})
+			i++
+			j++
+		case i < len(al) && (j == len(bl) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', al[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', bl[j]})
+			j++
+		}
+	}
+
+	const context = 3
+	lastPrinted := -1
+	for k, l := range lines {
+		if l.op == ' ' {
+			continue
+		}
+		start := max(k-context, lastPrinted+1)
+		if lastPrinted >= 0 && start > lastPrinted+1 {
+			fmt.Println("...")
+		}
+		end := min(k+context, len(lines)-1)
+		for p := start; p <= end; p++ {
+			if p <= lastPrinted {
+				continue
+			}
+			switch lines[p].op {
+			case '+':
+				fmt.Printf("%s+%s%s\n", colorGreen, lines[p].text, colorReset)
+			case '-':
+				fmt.Printf("%s-%s%s\n", colorRed, lines[p].text, colorReset)
+			default:
+				fmt.Printf(" %s\n", lines[p].text)
+			}
+			lastPrinted = p
+		}
+	}
+}
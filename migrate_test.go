@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateNodeDocs(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		notes   int
+		wantErr string
+	}{
+		{
+			name: "hostname moves to HostnameConfig",
+			in: `machine:
+  network:
+    hostname: cp-1
+    interfaces:
+      - interface: eth0
+`,
+			want: `machine:
+  network:
+    interfaces:
+      - interface: eth0
+---
+apiVersion: v1alpha1
+hostname: cp-1
+kind: HostnameConfig
+`,
+		},
+		{
+			name: "encryption moves to VolumeConfig, disks are kept",
+			in: `machine:
+  disks:
+    - device: /dev/sdb
+  systemDiskEncryption:
+    ephemeral:
+      provider: luks2
+`,
+			want: `machine:
+  disks:
+    - device: /dev/sdb
+---
+apiVersion: v1alpha1
+encryption:
+  provider: luks2
+kind: VolumeConfig
+name: EPHEMERAL
+`,
+			notes: 1,
+		},
+		{
+			name: "already migrated",
+			in: `machine: {}
+---
+apiVersion: v1alpha1
+hostname: cp-1
+kind: HostnameConfig
+`,
+			want: `machine: {}
+---
+apiVersion: v1alpha1
+hostname: cp-1
+kind: HostnameConfig
+`,
+		},
+		{
+			name: "hostname set twice",
+			in: `machine:
+  network:
+    hostname: cp-1
+---
+apiVersion: v1alpha1
+hostname: cp-1
+kind: HostnameConfig
+`,
+			wantErr: "both machine.network.hostname and HostnameConfig",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := decodeYAMLNodes([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			docs, notes, err := migrateNodeDocs(docs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := encodeYAMLNodes(docs, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("unexpected result:\n--- got ---\n%s\n--- want ---\n%s", got, tt.want)
+			}
+			if len(notes) != tt.notes {
+				t.Errorf("notes = %v, want %d", notes, tt.notes)
+			}
+		})
+	}
+}
+
+func TestMigrateConfigDir(t *testing.T) {
+	const (
+		oldImage    = "factory.talos.dev/nocloud-installer/abc:v1.11.5"
+		newImage    = "factory.talos.dev/nocloud-installer/abc:v1.12.6"
+		customImage = "registry.local/talos/installer:v1.11.5"
+	)
+	files := map[string]string{
+		"patch.yaml":   "machine:\n  install:\n    image: " + oldImage + "\n",
+		"cluster.yaml": "clusterName: t\nimage: " + oldImage + "\n",
+		"cp1.patch":    "machine:\n  network:\n    hostname: cp-1\n",
+		// образ, отличный от старого, не меняется
+		"worker1.yaml": "machine:\n    install:\n        image: " + customImage + "\n    network:\n        hostname: worker-1\n",
+		"notes.txt":    "image: " + oldImage + "\n",
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, err := migrateConfigDir(dir, oldImage, newImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"patch.yaml":   "machine:\n  install:\n    image: " + newImage + "\n",
+		"cluster.yaml": "clusterName: t\nimage: " + newImage + "\n",
+		"cp1.patch":    "machine:\n  network: {}\n---\napiVersion: v1alpha1\nhostname: cp-1\nkind: HostnameConfig\n",
+		"worker1.yaml": "machine:\n    install:\n        image: " + customImage + "\n    network: {}\n---\napiVersion: v1alpha1\nhostname: worker-1\nkind: HostnameConfig\n",
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d", len(changes), len(want))
+	}
+	for _, c := range changes {
+		name := filepath.Base(c.path)
+		if c.new != want[name] {
+			t.Errorf("%s:\n--- got ---\n%s\n--- want ---\n%s", name, c.new, want[name])
+		}
+		if err := os.WriteFile(c.path, []byte(c.new), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// повторный запуск на уже мигрированном каталоге ничего не меняет
+	changes, err = migrateConfigDir(dir, oldImage, newImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range changes {
+		t.Errorf("unexpected change on second run: %s\n%s", c.path, c.new)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.txt")); string(data) != files["notes.txt"] {
+		t.Errorf("files outside the config layout must not be touched")
+	}
+}
@@ -0,0 +1,1117 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	addressingStatic = "static"
+	addressingDHCP   = "dhcp"
+)
+
+// Подсети по умолчанию для IPv6 (talosctl по умолчанию выдает только IPv4)
+const (
+	defaultPodSubnet4     = "10.244.0.0/16"
+	defaultServiceSubnet4 = "10.96.0.0/12"
+	defaultPodSubnet6     = "fd00:10:244::/56"
+	defaultServiceSubnet6 = "fd00:10:96::/112"
+)
+
+// Группы нод для секции groups: в cluster.yaml
+const (
+	groupControlPlane = "controlplane"
+	groupWorker       = "worker"
+)
+
+// NodeConfig — настройки ноды из секции nodes: или группы из секции groups: в cluster.yaml.
+// Ключ nodes — hostname ноды (cp-1, worker-2, ...), ключ groups — controlplane или worker.
+// Пустые поля наследуются: нода -> группа -> кластер.
+type NodeConfig struct {
+	Addressing string        `yaml:"addressing,omitempty"`
+	Bond       *BondConfig   `yaml:"bond,omitempty"`
+	Bridge     *BridgeConfig `yaml:"bridge,omitempty"`
+	NIC        *NICSelector  `yaml:"nic,omitempty"`
+	Gateway    string        `yaml:"gateway,omitempty"`
+	Routes     []RouteConfig `yaml:"routes,omitempty"`
+
+	Disk                string            `yaml:"disk,omitempty"`
+	InstallDiskSelector *DiskSelector     `yaml:"installDiskSelector,omitempty"`
+	Encryption          *EncryptionConfig `yaml:"encryption,omitempty"`
+	Volumes             []VolumeSpec      `yaml:"volumes,omitempty"`
+	Ephemeral           *EphemeralConfig  `yaml:"ephemeral,omitempty"`
+
+	Labels map[string]string `yaml:"labels,omitempty"`
+	Taints map[string]string `yaml:"taints,omitempty"`
+	Zone   string            `yaml:"zone,omitempty"`
+	Region string            `yaml:"region,omitempty"`
+
+	MaxPods int `yaml:"maxPods,omitempty"`
+
+	Kubelet *KubeletConfig `yaml:"kubelet,omitempty"`
+}
+
+// NICSelector выбирает основной сетевой интерфейс ноды: по имени или по deviceSelector
+type NICSelector struct {
+	Name           string `yaml:"name,omitempty"`
+	DeviceSelector `yaml:",inline"`
+}
+
+// DeviceSelector выбирает сетевой интерфейс по его свойствам (machine.network.interfaces[].deviceSelector)
+type DeviceSelector struct {
+	HardwareAddr string `yaml:"hardwareAddr,omitempty"`
+	Driver       string `yaml:"driver,omitempty"`
+	BusPath      string `yaml:"busPath,omitempty"`
+	Physical     *bool  `yaml:"physical,omitempty"`
+}
+
+// celExpr переводит селектор в CEL-выражение для LinkAliasConfig (Talos >= 1.12).
+// Шаблоны со '*' сравниваются через glob.
+func (s DeviceSelector) celExpr() string {
+	var conds []string
+	match := func(field, value string) {
+		if strings.Contains(value, "*") {
+			conds = append(conds, fmt.Sprintf("glob(%q, %s)", value, field))
+		} else {
+			conds = append(conds, fmt.Sprintf("%s == %q", field, value))
+		}
+	}
+	if s.HardwareAddr != "" {
+		match("mac(link.permanent_addr)", strings.ToLower(s.HardwareAddr))
+	}
+	if s.Driver != "" {
+		match("link.driver", s.Driver)
+	}
+	if s.BusPath != "" {
+		match("link.bus_path", s.BusPath)
+	}
+	if s.Physical != nil {
+		// физический интерфейс — Ethernet-устройство без kind (не bond, bridge, vlan, ...)
+		if *s.Physical {
+			conds = append(conds, `link.type == 1 && link.kind == ""`)
+		} else {
+			conds = append(conds, `link.kind != ""`)
+		}
+	}
+	return strings.Join(conds, " && ")
+}
+
+// BondConfig описывает bond-интерфейс (например, LACP из двух портов)
+type BondConfig struct {
+	Name            string           `yaml:"name,omitempty"`
+	Interfaces      []string         `yaml:"interfaces,omitempty"`
+	DeviceSelectors []DeviceSelector `yaml:"deviceSelectors,omitempty"`
+	Mode            string           `yaml:"mode,omitempty"`
+	MIIMon          int              `yaml:"miimon,omitempty"`
+	LACPRate        string           `yaml:"lacpRate,omitempty"`
+}
+
+// BridgeConfig описывает Linux bridge (например, для виртуальных машин)
+type BridgeConfig struct {
+	Name       string   `yaml:"name,omitempty"`
+	Interfaces []string `yaml:"interfaces,omitempty"`
+	STP        bool     `yaml:"stp,omitempty"`
+}
+
+var bondModes = map[string]bool{
+	"balance-rr":    true,
+	"active-backup": true,
+	"balance-xor":   true,
+	"broadcast":     true,
+	"802.3ad":       true,
+	"balance-tlb":   true,
+	"balance-alb":   true,
+}
+
+// VLANConfig описывает VLAN-подинтерфейс на основном интерфейсе ноды.
+// Адреса нод задаются списками в том же порядке, что cpIPs и workerIPs.
+type VLANConfig struct {
+	VLANID    int           `yaml:"vlanId"`
+	Netmask   string        `yaml:"netmask,omitempty"`
+	CPIPs     []string      `yaml:"cpIPs,omitempty"`
+	WorkerIPs []string      `yaml:"workerIPs,omitempty"`
+	DHCP      bool          `yaml:"dhcp,omitempty"`
+	MTU       int           `yaml:"mtu,omitempty"`
+	Routes    []RouteConfig `yaml:"routes,omitempty"`
+}
+
+// RouteConfig описывает статический маршрут.
+// OnLink добавляет перед маршрутом link-scope маршрут до шлюза, если шлюз вне подсети интерфейса.
+type RouteConfig struct {
+	Network string `yaml:"network"`
+	Gateway string `yaml:"gateway,omitempty"`
+	Source  string `yaml:"source,omitempty"`
+	Metric  int    `yaml:"metric,omitempty"`
+	MTU     int    `yaml:"mtu,omitempty"`
+	OnLink  bool   `yaml:"onLink,omitempty"`
+	// Table — таблица маршрутизации: main, local, default или номер (Talos >= 1.12)
+	Table string `yaml:"table,omitempty"`
+}
+
+// nodeSpec описывает конкретную ноду при генерации ее патча
+type nodeSpec struct {
+	Hostname string
+	Index    int // позиция в cpIPs/workerIPs, с нуля
+	IP       string
+	IP6      string
+	IsCP     bool
+}
+
+// newNodeSpec собирает nodeSpec для i-й (с нуля) control plane или воркер-ноды
+func newNodeSpec(ans Answers, isCP bool, i int, ip string) nodeSpec {
+	if isCP {
+		return nodeSpec{Hostname: fmt.Sprintf("cp-%d", i+1), Index: i, IP: ip, IP6: indexOr(ans.CPIPs6, i), IsCP: true}
+	}
+	return nodeSpec{Hostname: fmt.Sprintf("worker-%d", i+1), Index: i, IP: ip, IP6: indexOr(ans.WorkerIPs6, i)}
+}
+
+// nodeGroup возвращает группу ноды по ее hostname
+func nodeGroup(hostname string) string {
+	if strings.HasPrefix(hostname, "cp-") {
+		return groupControlPlane
+	}
+	return groupWorker
+}
+
+// nodeLayers возвращает настройки ноды и ее группы в порядке приоритета
+func nodeLayers(ans Answers, hostname string) []NodeConfig {
+	var layers []NodeConfig
+	if node, ok := ans.Nodes[hostname]; ok {
+		layers = append(layers, node)
+	}
+	if group, ok := ans.Groups[nodeGroup(hostname)]; ok {
+		layers = append(layers, group)
+	}
+	return layers
+}
+
+// nodeAddressing возвращает режим адресации ноды: static или dhcp
+func nodeAddressing(ans Answers, hostname string) string {
+	for _, layer := range nodeLayers(ans, hostname) {
+		if layer.Addressing != "" {
+			return layer.Addressing
+		}
+	}
+	if ans.Addressing != "" {
+		return ans.Addressing
+	}
+	return addressingStatic
+}
+
+// nodeBond возвращает настройки bond для ноды (нода, группа или кластер)
+func nodeBond(ans Answers, hostname string) *BondConfig {
+	for _, layer := range nodeLayers(ans, hostname) {
+		if layer.Bond != nil {
+			return layer.Bond
+		}
+	}
+	return ans.Bond
+}
+
+// nodeBridge возвращает настройки bridge для ноды (нода, группа или кластер)
+func nodeBridge(ans Answers, hostname string) *BridgeConfig {
+	for _, layer := range nodeLayers(ans, hostname) {
+		if layer.Bridge != nil {
+			return layer.Bridge
+		}
+	}
+	return ans.Bridge
+}
+
+// nodeNIC возвращает способ выбора сетевого интерфейса для ноды (нода, группа или кластер).
+// nil означает поведение по умолчанию: CP — по имени iface, воркеры — любой физический.
+func nodeNIC(ans Answers, hostname string) *NICSelector {
+	for _, layer := range nodeLayers(ans, hostname) {
+		if layer.NIC != nil {
+			return layer.NIC
+		}
+	}
+	return ans.NIC
+}
+
+// linkSpec заполняет в записи интерфейса поле interface или deviceSelector
+func (n *NICSelector) linkSpec(iface map[string]interface{}) {
+	if n.Name != "" {
+		iface["interface"] = n.Name
+		return
+	}
+	iface["deviceSelector"] = n.DeviceSelector
+}
+
+func (b *BondConfig) name() string {
+	if b.Name == "" {
+		return "bond0"
+	}
+	return b.Name
+}
+
+func (b *BondConfig) mode() string {
+	if b.Mode == "" {
+		return "802.3ad"
+	}
+	return b.Mode
+}
+
+// spec формирует блок bond для machine.network.interfaces
+func (b *BondConfig) spec() map[string]interface{} {
+	bond := map[string]interface{}{"mode": b.mode()}
+	if len(b.Interfaces) > 0 {
+		bond["interfaces"] = b.Interfaces
+	}
+	if len(b.DeviceSelectors) > 0 {
+		bond["deviceSelectors"] = b.DeviceSelectors
+	}
+	miimon := b.MIIMon
+	if miimon == 0 {
+		miimon = 100
+	}
+	bond["miimon"] = miimon
+	if b.LACPRate != "" {
+		bond["lacpRate"] = b.LACPRate
+	}
+	return bond
+}
+
+func (b *BridgeConfig) name() string {
+	if b.Name == "" {
+		return "br0"
+	}
+	return b.Name
+}
+
+// nodeInterfaces формирует записи machine.network.interfaces для ноды.
+// Первой всегда идет запись, на которую ставятся адреса, маршруты и VIP:
+// bridge, если он задан, иначе bond, иначе сам сетевой интерфейс.
+// CP без bond/bridge привязываются к интерфейсу по имени, воркеры — к любому физическому.
+// При DHCP адреса и шлюз выдает DHCP-сервер, задаются только дополнительные маршруты routes.
+func nodeInterfaces(ans Answers, node nodeSpec) []map[string]interface{} {
+	iface := map[string]interface{}{}
+	var extra []map[string]interface{}
+	bond := nodeBond(ans, node.Hostname)
+	bridge := nodeBridge(ans, node.Hostname)
+	switch {
+	case bridge != nil:
+		ports := bridge.Interfaces
+		if len(ports) == 0 {
+			nic := nodeNIC(ans, node.Hostname)
+			switch {
+			case bond != nil:
+				ports = []string{bond.name()}
+			case nic != nil && nic.Name != "":
+				ports = []string{nic.Name}
+			default:
+				ports = []string{ans.Iface}
+			}
+		}
+		iface["interface"] = bridge.name()
+		iface["bridge"] = map[string]interface{}{
+			"interfaces": ports,
+			"stp":        map[string]interface{}{"enabled": bridge.STP},
+		}
+		if bond != nil {
+			extra = append(extra, map[string]interface{}{
+				"interface": bond.name(),
+				"bond":      bond.spec(),
+				"dhcp":      false,
+			})
+		}
+	case bond != nil:
+		iface["interface"] = bond.name()
+		iface["bond"] = bond.spec()
+	case nodeNIC(ans, node.Hostname) != nil:
+		nodeNIC(ans, node.Hostname).linkSpec(iface)
+	case node.IsCP:
+		iface["interface"] = ans.Iface
+	default:
+		physical := true
+		iface["deviceSelector"] = DeviceSelector{Physical: &physical}
+	}
+	interfaces := append([]map[string]interface{}{iface}, extra...)
+	if vlans := nodeVLANs(ans, node); len(vlans) > 0 {
+		iface["vlans"] = vlans
+	}
+
+	extraRoutes := routeSpecs(nodeRoutes(ans, node.Hostname))
+
+	if nodeAddressing(ans, node.Hostname) == addressingDHCP {
+		iface["dhcp"] = true
+		if len(extraRoutes) > 0 {
+			iface["routes"] = extraRoutes
+		}
+		return interfaces
+	}
+	iface["dhcp"] = false
+	addresses := []string{fmt.Sprintf("%s/%s", node.IP, ans.Netmask)}
+	routes := gatewayRoutes(nodeGateway(ans, node.Hostname), node.IP, ans.Netmask, ans.GatewayOnLink)
+	// dual-stack: второй адрес и маршрут по умолчанию для IPv6
+	if node.IP6 != "" {
+		addresses = append(addresses, fmt.Sprintf("%s/%s", node.IP6, ans.Netmask6))
+		routes = append(routes, gatewayRoutes(ans.Gateway6, node.IP6, ans.Netmask6, ans.GatewayOnLink)...)
+	}
+	iface["addresses"] = addresses
+	iface["routes"] = append(routes, extraRoutes...)
+	return interfaces
+}
+
+// nodeGateway возвращает шлюз по умолчанию для ноды (нода, группа или кластер)
+func nodeGateway(ans Answers, hostname string) string {
+	for _, layer := range nodeLayers(ans, hostname) {
+		if layer.Gateway != "" {
+			return layer.Gateway
+		}
+	}
+	return ans.Gateway
+}
+
+// nodeRoutes возвращает дополнительные маршруты ноды: кластера, группы и самой ноды
+func nodeRoutes(ans Answers, hostname string) []RouteConfig {
+	routes := append([]RouteConfig{}, ans.Routes...)
+	layers := nodeLayers(ans, hostname)
+	for i := len(layers) - 1; i >= 0; i-- {
+		routes = append(routes, layers[i].Routes...)
+	}
+	return routes
+}
+
+// inSubnet проверяет, что gateway попадает в подсеть addr/prefix
+func inSubnet(gateway, addr, prefix string) bool {
+	_, ipnet, err := net.ParseCIDR(fmt.Sprintf("%s/%s", strings.Split(addr, "/")[0], prefix))
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(gateway)
+	return ip != nil && ipnet.Contains(ip)
+}
+
+// hostRoute возвращает маршрут /32 (или /128) до адреса
+func hostRoute(addr string) string {
+	if isIPv6(addr) {
+		return addr + "/128"
+	}
+	return addr + "/32"
+}
+
+// gatewayRoutes формирует маршрут по умолчанию через gateway.
+// Если шлюз вне подсети интерфейса (адреса /32 у хостеров вроде Hetzner) или onLink
+// включен явно, перед ним добавляется link-scope маршрут до самого шлюза.
+func gatewayRoutes(gateway, addr, prefix string, onLink bool) []map[string]interface{} {
+	var routes []map[string]interface{}
+	if onLink || !inSubnet(gateway, addr, prefix) {
+		routes = append(routes, map[string]interface{}{"network": hostRoute(gateway)})
+	}
+	return append(routes, map[string]interface{}{"network": defaultRoute(gateway), "gateway": gateway})
+}
+
+// routeSpecs формирует записи routes для machine.network.interfaces
+func routeSpecs(routes []RouteConfig) []map[string]interface{} {
+	var specs []map[string]interface{}
+	for _, r := range routes {
+		if r.OnLink && r.Gateway != "" {
+			specs = append(specs, map[string]interface{}{"network": hostRoute(r.Gateway)})
+		}
+		spec := map[string]interface{}{"network": r.Network}
+		if r.Gateway != "" {
+			spec["gateway"] = r.Gateway
+		}
+		if r.Source != "" {
+			spec["source"] = r.Source
+		}
+		if r.Metric > 0 {
+			spec["metric"] = r.Metric
+		}
+		if r.MTU > 0 {
+			spec["mtu"] = r.MTU
+		}
+		if r.Table != "" {
+			spec["table"] = r.routeTable()
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// routeTableNames — именованные таблицы маршрутизации Talos
+var routeTableNames = map[string]bool{"main": true, "local": true, "default": true}
+
+// routeTable возвращает таблицу для документа: номер числом, иначе имя
+func (r RouteConfig) routeTable() interface{} {
+	if n, err := strconv.ParseUint(r.Table, 10, 32); err == nil {
+		return n
+	}
+	return r.Table
+}
+
+// validateRoutes проверяет дополнительные маршруты кластера, групп и нод
+func validateRoutes(ans Answers, talosVersion string) error {
+	check := func(scope string, routes []RouteConfig) error {
+		for _, r := range routes {
+			_, ipnet, err := net.ParseCIDR(r.Network)
+			if err != nil {
+				return fmt.Errorf("%sroutes: invalid network %q", scope, r.Network)
+			}
+			v6 := ipnet.IP.To4() == nil
+			for _, addr := range []string{r.Gateway, r.Source} {
+				if addr == "" {
+					continue
+				}
+				if net.ParseIP(addr) == nil {
+					return fmt.Errorf("%sroutes: invalid address %q", scope, addr)
+				}
+				if isIPv6(addr) != v6 {
+					return fmt.Errorf("%sroutes: %s and %s are of different IP families", scope, r.Network, addr)
+				}
+			}
+			if r.Metric < 0 || r.MTU < 0 {
+				return fmt.Errorf("%sroutes: metric and mtu must not be negative", scope)
+			}
+			if r.OnLink && r.Gateway == "" {
+				return fmt.Errorf("%sroutes: onLink requires gateway", scope)
+			}
+			if r.Table != "" {
+				if !isTalosVersionAtLeast(talosVersion, 1, 12) {
+					return fmt.Errorf("%sroutes: table requires Talos >= 1.12 (machine.network routes always go to the main routing table)", scope)
+				}
+				if n, err := strconv.ParseUint(r.Table, 10, 32); (err != nil || n == 0) && !routeTableNames[r.Table] {
+					return fmt.Errorf("%sroutes: invalid table %q (expected main, local, default or a number 1-4294967295)", scope, r.Table)
+				}
+			}
+		}
+		return nil
+	}
+	if err := check("", ans.Routes); err != nil {
+		return err
+	}
+	for _, v := range ans.VLANs {
+		if err := check(fmt.Sprintf("vlans[%d].", v.VLANID), v.Routes); err != nil {
+			return err
+		}
+	}
+	for name, group := range ans.Groups {
+		if err := check(fmt.Sprintf("groups.%s.", name), group.Routes); err != nil {
+			return err
+		}
+	}
+	for name, node := range ans.Nodes {
+		if err := check(fmt.Sprintf("nodes.%s.", name), node.Routes); err != nil {
+			return err
+		}
+		if node.Gateway != "" && net.ParseIP(node.Gateway) == nil {
+			return fmt.Errorf("nodes.%s: invalid gateway %q", name, node.Gateway)
+		}
+	}
+	return nil
+}
+
+// nodeVLANs формирует список vlans основного интерфейса ноды
+func nodeVLANs(ans Answers, node nodeSpec) []map[string]interface{} {
+	var vlans []map[string]interface{}
+	for _, v := range ans.VLANs {
+		vlan := map[string]interface{}{"vlanId": v.VLANID}
+		if v.MTU > 0 {
+			vlan["mtu"] = v.MTU
+		}
+		ips := v.WorkerIPs
+		if node.IsCP {
+			ips = v.CPIPs
+		}
+		if ip := indexOr(ips, node.Index); ip != "" {
+			vlan["dhcp"] = false
+			vlan["addresses"] = []string{fmt.Sprintf("%s/%s", ip, v.Netmask)}
+		} else {
+			vlan["dhcp"] = v.DHCP
+		}
+		if len(v.Routes) > 0 {
+			vlan["routes"] = routeSpecs(v.Routes)
+		}
+		vlans = append(vlans, vlan)
+	}
+	return vlans
+}
+
+// addedNodeAnswers готовит Answers для ноды, добавляемой командой add.
+// Адреса VLAN и MAC новой ноды берутся из флагов (<vlanId>=<ip> и --mac), остальные параметры —
+// из секций кластера, группы и самой ноды в cluster.yaml, а не из патча первой ноды.
+func addedNodeAnswers(ans Answers, spec nodeSpec, mac string, vlanAddresses []string) (Answers, error) {
+	byID := map[string]string{}
+	for _, a := range vlanAddresses {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 || net.ParseIP(parts[1]) == nil {
+			return ans, fmt.Errorf("invalid --vlan-address %q, expected <vlanId>=<ip>", a)
+		}
+		byID[parts[0]] = parts[1]
+	}
+
+	dualStack := len(ans.CPIPs6) > 0 || len(ans.WorkerIPs6) > 0
+	if dualStack && spec.IP6 == "" && nodeAddressing(ans, spec.Hostname) == addressingStatic {
+		return ans, fmt.Errorf("cluster is dual-stack, specify --address6 for the new node")
+	}
+
+	nodes := map[string]NodeConfig{}
+	for name, node := range ans.Nodes {
+		nodes[name] = node
+	}
+	node, declared := nodes[spec.Hostname]
+	// интерфейс, выбранный по MAC, у каждой ноды свой
+	if mac != "" {
+		node.NIC = &NICSelector{DeviceSelector: DeviceSelector{HardwareAddr: mac}}
+		nodes[spec.Hostname] = node
+	} else if nic := nodeNIC(ans, spec.Hostname); nic != nil && nic.HardwareAddr != "" && (!declared || node.NIC == nil) {
+		return ans, fmt.Errorf("nodes select network interface by MAC, specify --mac for the new node")
+	}
+	ans.Nodes = nodes
+	// новая нода должна попасть в проверки, которые перебирают cp-1..N и worker-1..N
+	if spec.IsCP {
+		ans.CPCount = max(ans.CPCount, spec.Index+1)
+	} else {
+		ans.WorkerCount = max(ans.WorkerCount, spec.Index+1)
+	}
+
+	var vlans []VLANConfig
+	for _, v := range ans.VLANs {
+		ips := &v.WorkerIPs
+		if spec.IsCP {
+			ips = &v.CPIPs
+		}
+		if len(*ips) > 0 {
+			ip, ok := byID[fmt.Sprint(v.VLANID)]
+			if !ok {
+				return ans, fmt.Errorf("VLAN %d has static node addresses, specify --vlan-address %d=<ip>", v.VLANID, v.VLANID)
+			}
+			list := make([]string, max(len(*ips), spec.Index+1))
+			copy(list, *ips)
+			list[spec.Index] = ip
+			*ips = list
+		}
+		vlans = append(vlans, v)
+	}
+	ans.VLANs = vlans
+	return ans, nil
+}
+
+// validateVLANs проверяет VLAN: номера, адреса нод и подсети для kubelet/etcd
+func validateVLANs(ans Answers) error {
+	seen := map[int]bool{}
+	for _, v := range ans.VLANs {
+		if v.VLANID < 1 || v.VLANID > 4094 {
+			return fmt.Errorf("vlans: vlanId %d is out of range 1-4094", v.VLANID)
+		}
+		if seen[v.VLANID] {
+			return fmt.Errorf("vlans: duplicate vlanId %d", v.VLANID)
+		}
+		seen[v.VLANID] = true
+		if v.DHCP {
+			if len(v.CPIPs) > 0 || len(v.WorkerIPs) > 0 {
+				return fmt.Errorf("vlans[%d]: dhcp and static addresses are mutually exclusive", v.VLANID)
+			}
+			continue
+		}
+		if v.Netmask == "" {
+			return fmt.Errorf("vlans[%d]: netmask is required for static addresses", v.VLANID)
+		}
+		if len(v.CPIPs) != ans.CPCount || len(v.WorkerIPs) != ans.WorkerCount {
+			return fmt.Errorf("vlans[%d]: expected %d cpIPs and %d workerIPs", v.VLANID, ans.CPCount, ans.WorkerCount)
+		}
+		for _, ip := range append(append([]string{}, v.CPIPs...), v.WorkerIPs...) {
+			if net.ParseIP(ip) == nil {
+				return fmt.Errorf("vlans[%d]: invalid IP address %q", v.VLANID, ip)
+			}
+		}
+	}
+	for _, subnet := range append(append([]string{}, ans.KubeletValidSubnets...), ans.EtcdAdvertisedSubnets...) {
+		if _, _, err := net.ParseCIDR(strings.TrimPrefix(subnet, "!")); err != nil {
+			return fmt.Errorf("invalid subnet %q in kubeletValidSubnets/etcdAdvertisedSubnets", subnet)
+		}
+	}
+	return nil
+}
+
+// validateLinks проверяет настройки bond и bridge кластера и отдельных нод
+func validateLinks(ans Answers) error {
+	check := func(scope string, bond *BondConfig, bridge *BridgeConfig) error {
+		if bond != nil {
+			if len(bond.Interfaces) == 0 && len(bond.DeviceSelectors) == 0 {
+				return fmt.Errorf("%sbond: set interfaces or deviceSelectors", scope)
+			}
+			if len(bond.Interfaces) > 0 && len(bond.DeviceSelectors) > 0 {
+				return fmt.Errorf("%sbond: interfaces and deviceSelectors are mutually exclusive", scope)
+			}
+			if !bondModes[bond.mode()] {
+				return fmt.Errorf("%sbond: unknown mode %q", scope, bond.Mode)
+			}
+			if bond.LACPRate != "" {
+				if bond.mode() != "802.3ad" {
+					return fmt.Errorf("%sbond: lacpRate is only valid for mode 802.3ad", scope)
+				}
+				if bond.LACPRate != "slow" && bond.LACPRate != "fast" {
+					return fmt.Errorf("%sbond: lacpRate must be slow or fast", scope)
+				}
+			}
+		}
+		if bridge != nil && bond != nil && bridge.name() == bond.name() {
+			return fmt.Errorf("%sbridge and bond must have different names", scope)
+		}
+		return nil
+	}
+	checkNIC := func(scope string, nic *NICSelector) error {
+		if nic == nil {
+			return nil
+		}
+		set := 0
+		for _, v := range []string{nic.Name, nic.HardwareAddr, nic.Driver, nic.BusPath} {
+			if v != "" {
+				set++
+			}
+		}
+		if nic.Physical != nil {
+			set++
+		}
+		if set == 0 {
+			return fmt.Errorf("%snic: set name, hardwareAddr, driver, busPath or physical", scope)
+		}
+		if nic.Name != "" && set > 1 {
+			return fmt.Errorf("%snic: name and deviceSelector fields are mutually exclusive", scope)
+		}
+		return nil
+	}
+	if err := check("", ans.Bond, ans.Bridge); err != nil {
+		return err
+	}
+	if err := checkNIC("", ans.NIC); err != nil {
+		return err
+	}
+	for name, group := range ans.Groups {
+		if name != groupControlPlane && name != groupWorker {
+			return fmt.Errorf("unknown group %q (expected %s or %s)", name, groupControlPlane, groupWorker)
+		}
+		if err := check(fmt.Sprintf("groups.%s.", name), group.Bond, group.Bridge); err != nil {
+			return err
+		}
+		if err := checkNIC(fmt.Sprintf("groups.%s.", name), group.NIC); err != nil {
+			return err
+		}
+	}
+	for name, node := range ans.Nodes {
+		if err := check(fmt.Sprintf("nodes.%s.", name), nodeBond(ans, name), nodeBridge(ans, name)); err != nil {
+			return err
+		}
+		if err := checkNIC(fmt.Sprintf("nodes.%s.", name), node.NIC); err != nil {
+			return err
+		}
+	}
+
+	// порт bridge без явных interfaces: bond, имя NIC или iface
+	var hostnames []string
+	for i := 0; i < ans.CPCount; i++ {
+		hostnames = append(hostnames, fmt.Sprintf("cp-%d", i+1))
+	}
+	for i := 0; i < ans.WorkerCount; i++ {
+		hostnames = append(hostnames, fmt.Sprintf("worker-%d", i+1))
+	}
+	for _, hostname := range hostnames {
+		bridge := nodeBridge(ans, hostname)
+		if bridge == nil || len(bridge.Interfaces) > 0 || nodeBond(ans, hostname) != nil {
+			continue
+		}
+		nic := nodeNIC(ans, hostname)
+		if nic != nil && nic.Name == "" {
+			return fmt.Errorf("%s: bridge ports are set by name, but nic is chosen by deviceSelector; set nic.name, bridge.interfaces or a bond", hostname)
+		}
+		if nic == nil && ans.Iface == "" {
+			return fmt.Errorf("%s: bridge has no interfaces and no network interface name is set, add bridge.interfaces or nic", hostname)
+		}
+	}
+	return nil
+}
+
+// isIPv6 проверяет, что строка — IPv6-адрес (допускается суффикс /prefix)
+func isIPv6(addr string) bool {
+	ip := net.ParseIP(strings.Split(addr, "/")[0])
+	return ip != nil && ip.To4() == nil
+}
+
+// defaultRoute возвращает маршрут по умолчанию для семейства адреса шлюза
+func defaultRoute(gateway string) string {
+	if isIPv6(gateway) {
+		return "::/0"
+	}
+	return "0.0.0.0/0"
+}
+
+// hostForURL заключает IPv6-адрес в квадратные скобки для использования в URL
+func hostForURL(addr string) string {
+	addr = strings.Split(addr, "/")[0]
+	if isIPv6(addr) {
+		return "[" + addr + "]"
+	}
+	return addr
+}
+
+// kubeAPIURL возвращает адрес Kubernetes API для talosctl gen config
+func kubeAPIURL(addr string) string {
+	return fmt.Sprintf("https://%s:6443", hostForURL(addr))
+}
+
+// talosEndpoint возвращает endpoint apid для talosconfig и флага --endpoints.
+// IPv6 указывается в скобках с портом, иначе talosctl не отделит порт от адреса.
+func talosEndpoint(addr string) string {
+	addr = strings.Split(addr, "/")[0]
+	if isIPv6(addr) {
+		return net.JoinHostPort(addr, fmt.Sprint(talosAPIPort))
+	}
+	return addr
+}
+
+// talosconfigEndpoint возвращает endpoint для talosconfig и команд из commands.md.
+// IPv6 берется в кавычки: без них скобки читаются как вложенный список YAML или glob в shell.
+func talosconfigEndpoint(addr string) string {
+	ep := talosEndpoint(addr)
+	if strings.HasPrefix(ep, "[") {
+		return fmt.Sprintf("%q", ep)
+	}
+	return ep
+}
+
+// clusterSubnets возвращает podSubnets и serviceSubnets для cluster.network.
+// Если подсети не заданы, а в кластере есть IPv6, подставляются значения по умолчанию
+// для нужных семейств; для чистого IPv4 остаются умолчания talosctl.
+func clusterSubnets(ans Answers, cpIPs []string) ([]string, []string) {
+	if len(ans.PodSubnets) > 0 || len(ans.ServiceSubnets) > 0 {
+		return ans.PodSubnets, ans.ServiceSubnets
+	}
+	has4, has6 := false, len(ans.CPIPs6) > 0
+	for _, ip := range cpIPs {
+		if isIPv6(ip) {
+			has6 = true
+		} else {
+			has4 = true
+		}
+	}
+	if !has6 {
+		return nil, nil
+	}
+	var pods, services []string
+	if has4 {
+		pods = append(pods, defaultPodSubnet4)
+		services = append(services, defaultServiceSubnet4)
+	}
+	pods = append(pods, defaultPodSubnet6)
+	services = append(services, defaultServiceSubnet6)
+	return pods, services
+}
+
+// validateVIP проверяет, что IPv6 VIP попадает в префикс интерфейса control plane
+func validateVIP(ans Answers, cpIPs []string) error {
+	if !ans.UseVIP || ans.VIPIP == "" || !isIPv6(ans.VIPIP) || len(cpIPs) == 0 {
+		return nil
+	}
+	if nodeAddressing(ans, "cp-1") == addressingDHCP {
+		return nil
+	}
+	cpAddr, prefix := cpIPs[0], ans.Netmask
+	if !isIPv6(cpAddr) {
+		if len(ans.CPIPs6) == 0 {
+			return fmt.Errorf("IPv6 VIP %s requires IPv6 addresses on control planes (cpIPs6)", ans.VIPIP)
+		}
+		cpAddr, prefix = ans.CPIPs6[0], ans.Netmask6
+	}
+	_, ipnet, err := net.ParseCIDR(fmt.Sprintf("%s/%s", strings.Split(cpAddr, "/")[0], prefix))
+	if err != nil {
+		return fmt.Errorf("invalid control plane IPv6 address %s/%s: %v", cpAddr, prefix, err)
+	}
+	vip := net.ParseIP(strings.Split(ans.VIPIP, "/")[0])
+	if !ipnet.Contains(vip) {
+		return fmt.Errorf("IPv6 VIP %s is outside of the interface prefix %s", ans.VIPIP, ipnet)
+	}
+	return nil
+}
+
+// indexOr возвращает элемент списка или пустую строку, если его нет
+func indexOr(list []string, i int) string {
+	if i < len(list) {
+		return list[i]
+	}
+	return ""
+}
+
+// validateAddressing проверяет режимы адресации и наличие параметров для статических нод
+func validateAddressing(ans Answers, cpIPs, workerIPs []string) error {
+	for _, mode := range append([]string{ans.Addressing}, addressingModes(ans)...) {
+		if mode != "" && mode != addressingStatic && mode != addressingDHCP {
+			return fmt.Errorf("unknown addressing mode %q (expected static or dhcp)", mode)
+		}
+	}
+	for name := range ans.Nodes {
+		if !knownHostname(name, ans.CPCount, ans.WorkerCount) {
+			return fmt.Errorf("nodes.%s does not match any node (expected cp-N or worker-N)", name)
+		}
+	}
+	check := func(hostname, ip string) error {
+		if net.ParseIP(strings.Split(ip, "/")[0]) == nil {
+			return fmt.Errorf("%s: invalid IP address %q", hostname, ip)
+		}
+		if nodeAddressing(ans, hostname) != addressingStatic {
+			return nil
+		}
+		gateway := nodeGateway(ans, hostname)
+		if gateway == "" || ans.Netmask == "" {
+			return fmt.Errorf("%s: static addressing requires gateway and netmask", hostname)
+		}
+		if isIPv6(ip) != isIPv6(gateway) {
+			return fmt.Errorf("%s: address %s and gateway %s are of different IP families", hostname, ip, gateway)
+		}
+		return nil
+	}
+	if len(ans.CPIPs6) > 0 || len(ans.WorkerIPs6) > 0 {
+		if ans.Gateway6 == "" || ans.Netmask6 == "" {
+			return fmt.Errorf("cpIPs6/workerIPs6 require gateway6 and netmask6")
+		}
+		for _, ip := range append(append([]string{}, ans.CPIPs6...), ans.WorkerIPs6...) {
+			if !isIPv6(ip) {
+				return fmt.Errorf("invalid IPv6 address %q in cpIPs6/workerIPs6", ip)
+			}
+		}
+	}
+	for i, ip := range cpIPs {
+		if err := check(fmt.Sprintf("cp-%d", i+1), ip); err != nil {
+			return err
+		}
+	}
+	for i, ip := range workerIPs {
+		if err := check(fmt.Sprintf("worker-%d", i+1), ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addressingModes возвращает режимы адресации, заданные в группах и нодах
+func addressingModes(ans Answers) []string {
+	var modes []string
+	for _, group := range ans.Groups {
+		modes = append(modes, group.Addressing)
+	}
+	for _, node := range ans.Nodes {
+		modes = append(modes, node.Addressing)
+	}
+	return modes
+}
+
+// knownHostname проверяет, что hostname соответствует одной из нод кластера
+func knownHostname(hostname string, cpCount, workerCount int) bool {
+	for i := 1; i <= cpCount; i++ {
+		if hostname == fmt.Sprintf("cp-%d", i) {
+			return true
+		}
+	}
+	for i := 1; i <= workerCount; i++ {
+		if hostname == fmt.Sprintf("worker-%d", i) {
+			return true
+		}
+	}
+	return false
+}
+
+// Размер pod CIDR ноды по умолчанию в kube-controller-manager и maxPods kubelet по умолчанию
+const (
+	defaultNodeCIDRMaskSize4 = 24
+	defaultNodeCIDRMaskSize6 = 64
+	defaultMaxPods           = 110
+	legacyMaxPods            = 512
+)
+
+// nodeMaxPods возвращает maxPods для ноды (нода, группа, кластер); 0 — значение kubelet по умолчанию.
+// useMaxPods из мастера соответствует maxPods: 512 для всех нод.
+func nodeMaxPods(ans Answers, hostname string) int {
+	for _, layer := range nodeLayers(ans, hostname) {
+		if layer.MaxPods > 0 {
+			return layer.MaxPods
+		}
+	}
+	if ans.MaxPods > 0 {
+		return ans.MaxPods
+	}
+	if ans.UseMaxPods {
+		return legacyMaxPods
+	}
+	return 0
+}
+
+// nodeCIDRMaskSizes возвращает размер pod CIDR ноды для IPv4 и IPv6
+func nodeCIDRMaskSizes(ans Answers) (int, int) {
+	mask4, mask6 := ans.NodeCIDRMaskSize, ans.NodeCIDRMaskSize6
+	if mask4 == 0 {
+		mask4 = defaultNodeCIDRMaskSize4
+	}
+	if mask6 == 0 {
+		mask6 = defaultNodeCIDRMaskSize6
+	}
+	return mask4, mask6
+}
+
+// controllerManagerCIDRArgs возвращает флаги kube-controller-manager для размера pod CIDR нод.
+// В dual-stack размер задается отдельно для каждого семейства.
+func controllerManagerCIDRArgs(ans Answers, podSubnets []string) map[string]string {
+	if ans.NodeCIDRMaskSize == 0 && ans.NodeCIDRMaskSize6 == 0 {
+		return nil
+	}
+	mask4, mask6 := nodeCIDRMaskSizes(ans)
+	has4, has6 := false, false
+	for _, s := range podSubnets {
+		if isIPv6(s) {
+			has6 = true
+		} else {
+			has4 = true
+		}
+	}
+	switch {
+	case has4 && has6:
+		return map[string]string{
+			"node-cidr-mask-size-ipv4": strconv.Itoa(mask4),
+			"node-cidr-mask-size-ipv6": strconv.Itoa(mask6),
+		}
+	case has6:
+		return map[string]string{"node-cidr-mask-size": strconv.Itoa(mask6)}
+	default:
+		return map[string]string{"node-cidr-mask-size": strconv.Itoa(mask4)}
+	}
+}
+
+// effectiveSubnets возвращает podSubnets и serviceSubnets кластера с учетом значений Talos по умолчанию
+func effectiveSubnets(ans Answers, cpIPs []string) ([]string, []string) {
+	pods, services := clusterSubnets(ans, cpIPs)
+	if len(pods) == 0 {
+		pods = []string{defaultPodSubnet4}
+	}
+	if len(services) == 0 {
+		services = []string{defaultServiceSubnet4}
+	}
+	return pods, services
+}
+
+// validateClusterNetwork проверяет, что pod CIDR ноды вмещает maxPods, pod-подсеть вмещает все ноды,
+// а podSubnets и serviceSubnets не пересекаются между собой, с сетью нод и VIP.
+func validateClusterNetwork(ans Answers, cpIPs, workerIPs []string) error {
+	pods, services := effectiveSubnets(ans, cpIPs)
+	mask4, mask6 := nodeCIDRMaskSizes(ans)
+	if mask4 < 8 || mask4 > 30 || mask6 < 64 || mask6 > 126 {
+		return fmt.Errorf("nodeCIDRMaskSize must be 8..30 and nodeCIDRMaskSize6 64..126")
+	}
+
+	maxPods, maxPodsNode := defaultMaxPods, ""
+	hostnames := make([]string, 0, len(cpIPs)+len(workerIPs))
+	for i := range cpIPs {
+		hostnames = append(hostnames, fmt.Sprintf("cp-%d", i+1))
+	}
+	for i := range workerIPs {
+		hostnames = append(hostnames, fmt.Sprintf("worker-%d", i+1))
+	}
+	for _, hostname := range hostnames {
+		if n := nodeMaxPods(ans, hostname); n > maxPods {
+			maxPods, maxPodsNode = n, hostname
+		}
+	}
+	// useMaxPods из мастера задает 512 без учета pod CIDR: только предупреждаем, чтобы не ломать старые cluster.yaml
+	legacyOnly := ans.MaxPods == 0 && maxPods == legacyMaxPods && ans.UseMaxPods
+	for _, layer := range nodeLayers(ans, maxPodsNode) {
+		if layer.MaxPods > 0 {
+			legacyOnly = false
+		}
+	}
+	for name, group := range ans.Groups {
+		if group.MaxPods < 0 {
+			return fmt.Errorf("groups.%s.maxPods must be positive", name)
+		}
+	}
+	if ans.MaxPods < 0 {
+		return fmt.Errorf("maxPods must be positive")
+	}
+
+	var subnets []*net.IPNet
+	var names []string
+	for _, list := range []struct {
+		name  string
+		cidrs []string
+	}{{"podSubnets", pods}, {"serviceSubnets", services}} {
+		for _, cidr := range list.cidrs {
+			_, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("%s: invalid CIDR %q", list.name, cidr)
+			}
+			subnets = append(subnets, ipnet)
+			names = append(names, fmt.Sprintf("%s %s", list.name, cidr))
+			if list.name != "podSubnets" {
+				continue
+			}
+			prefix, bits := ipnet.Mask.Size()
+			mask := mask4
+			if bits == 128 {
+				mask = mask6
+			}
+			if mask <= prefix {
+				return fmt.Errorf("podSubnets %s: node CIDR /%d must be smaller than the subnet", cidr, mask)
+			}
+			if bits == 128 && mask-prefix > 16 {
+				return fmt.Errorf("podSubnets %s: node CIDR /%d is too small, the difference with the subnet prefix must be at most 16", cidr, mask)
+			}
+			if mask-prefix < 31 && 1<<uint(mask-prefix) < len(hostnames) {
+				return fmt.Errorf("podSubnets %s holds %d node CIDRs /%d, but the cluster has %d nodes", cidr, 1<<uint(mask-prefix), mask, len(hostnames))
+			}
+			if bits == 32 {
+				if capacity := 1<<uint(32-mask) - 2; capacity < maxPods {
+					node := ""
+					if maxPodsNode != "" {
+						node = " on " + maxPodsNode
+					}
+					if !legacyOnly {
+						return fmt.Errorf("node pod CIDR /%d holds %d pods, but maxPods is %d%s: decrease nodeCIDRMaskSize", mask, capacity, maxPods, node)
+					}
+					fmt.Printf("%s⚠️  node pod CIDR /%d holds %d pods, but maxPods is %d%s: set nodeCIDRMaskSize (e.g. 22)%s\n", colorYellow, mask, capacity, maxPods, node, colorReset)
+				}
+			}
+		}
+	}
+
+	for i := range subnets {
+		for j := i + 1; j < len(subnets); j++ {
+			if subnets[i].Contains(subnets[j].IP) || subnets[j].Contains(subnets[i].IP) {
+				return fmt.Errorf("%s overlaps %s", names[i], names[j])
+			}
+		}
+	}
+
+	// сеть нод: адреса со своей маской; при DHCP маска может быть не задана
+	var nodeNets []string
+	for _, ip := range append(append([]string{}, cpIPs...), workerIPs...) {
+		if ans.Netmask != "" && !isIPv6(ip) {
+			nodeNets = append(nodeNets, fmt.Sprintf("%s/%s", strings.Split(ip, "/")[0], ans.Netmask))
+		}
+	}
+	for _, ip := range append(append([]string{}, ans.CPIPs6...), ans.WorkerIPs6...) {
+		if ans.Netmask6 != "" {
+			nodeNets = append(nodeNets, fmt.Sprintf("%s/%s", strings.Split(ip, "/")[0], ans.Netmask6))
+		}
+	}
+	for _, cidr := range nodeNets {
+		ip, nodeNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		for i, s := range subnets {
+			if s.Contains(ip) || nodeNet.Contains(s.IP) {
+				return fmt.Errorf("%s overlaps node network %s", names[i], nodeNet)
+			}
+		}
+	}
+	if ans.UseVIP && ans.VIPIP != "" {
+		if vip := net.ParseIP(strings.Split(ans.VIPIP, "/")[0]); vip != nil {
+			for i, s := range subnets {
+				if s.Contains(vip) {
+					return fmt.Errorf("VIP %s is inside %s", ans.VIPIP, names[i])
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNodeInterfacesDHCPRoutes(t *testing.T) {
+	ans := Answers{
+		Iface:      "eth0",
+		Gateway:    "10.0.0.1",
+		Netmask:    "24",
+		Addressing: addressingDHCP,
+		Routes:     []RouteConfig{{Network: "10.10.0.0/16", Gateway: "10.0.0.254", Metric: 100}},
+	}
+	interfaces := nodeInterfaces(ans, newNodeSpec(ans, true, 0, "10.0.0.5"))
+	iface := interfaces[0]
+	if iface["dhcp"] != true {
+		t.Fatalf("dhcp = %v, want true", iface["dhcp"])
+	}
+	if _, ok := iface["addresses"]; ok {
+		t.Errorf("DHCP interface must not have static addresses: %v", iface["addresses"])
+	}
+	want := []map[string]interface{}{{"network": "10.10.0.0/16", "gateway": "10.0.0.254", "metric": 100}}
+	if !reflect.DeepEqual(iface["routes"], want) {
+		t.Errorf("routes = %v, want %v", iface["routes"], want)
+	}
+}
+
+func TestValidateRoutesTable(t *testing.T) {
+	tests := []struct {
+		table   string
+		version string
+		wantErr string
+	}{
+		{"100", "1.12.6", ""},
+		{"main", "1.12.0", ""},
+		{"100", "1.11.5", "requires Talos >= 1.12"},
+		{"0", "1.12.6", "invalid table"},
+		{"vpn", "1.12.6", "invalid table"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.table+"@"+tt.version, func(t *testing.T) {
+			ans := Answers{Routes: []RouteConfig{{Network: "10.10.0.0/16", Gateway: "10.0.0.254", Table: tt.table}}}
+			err := validateRoutes(ans, tt.version)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateRoutes() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLinksBridgeOverSelectedNIC(t *testing.T) {
+	ans := Answers{
+		CPCount: 1,
+		Iface:   "eth0",
+		NIC:     &NICSelector{DeviceSelector: DeviceSelector{HardwareAddr: "aa:bb:cc:dd:ee:ff"}},
+		Bridge:  &BridgeConfig{},
+	}
+	if err := validateLinks(ans); err == nil || !strings.Contains(err.Error(), "deviceSelector") {
+		t.Errorf("expected bridge over deviceSelector error, got %v", err)
+	}
+	ans.NIC = &NICSelector{Name: "eth1"}
+	if err := validateLinks(ans); err != nil {
+		t.Errorf("bridge over a named nic: %v", err)
+	}
+	ans.NIC = &NICSelector{DeviceSelector: DeviceSelector{HardwareAddr: "aa:bb:cc:dd:ee:ff"}}
+	ans.Bond = &BondConfig{Interfaces: []string{"eth0", "eth1"}}
+	if err := validateLinks(ans); err != nil {
+		t.Errorf("bridge over a bond: %v", err)
+	}
+}
+
+func TestAddedNodeAnswers(t *testing.T) {
+	ans := Answers{
+		Gateway: "10.0.0.1",
+		Netmask: "24",
+		NIC:     &NICSelector{DeviceSelector: DeviceSelector{HardwareAddr: "aa:bb:cc:dd:ee:01"}},
+		VLANs:   []VLANConfig{{VLANID: 20, Netmask: "24", WorkerIPs: []string{"10.0.20.11"}}},
+		Nodes: map[string]NodeConfig{
+			"worker-1": {NIC: &NICSelector{DeviceSelector: DeviceSelector{HardwareAddr: "aa:bb:cc:dd:ee:01"}}, MaxPods: 200},
+		},
+	}
+	spec := newNodeSpec(ans, false, 1, "10.0.0.12")
+
+	if _, err := addedNodeAnswers(ans, spec, "", []string{"20=10.0.20.12"}); err == nil {
+		t.Errorf("expected error without --mac")
+	}
+	if _, err := addedNodeAnswers(ans, spec, "aa:bb:cc:dd:ee:02", nil); err == nil {
+		t.Errorf("expected error without --vlan-address")
+	}
+
+	got, err := addedNodeAnswers(ans, spec, "aa:bb:cc:dd:ee:02", []string{"20=10.0.20.12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nic := nodeNIC(got, "worker-2"); nic == nil || nic.HardwareAddr != "aa:bb:cc:dd:ee:02" {
+		t.Errorf("worker-2 nic = %+v", nic)
+	}
+	if nodeMaxPods(got, "worker-2") != 0 {
+		t.Errorf("worker-1 maxPods leaked into worker-2")
+	}
+	if !reflect.DeepEqual(got.VLANs[0].WorkerIPs, []string{"10.0.20.11", "10.0.20.12"}) {
+		t.Errorf("vlan workerIPs = %v", got.VLANs[0].WorkerIPs)
+	}
+	if _, ok := ans.Nodes["worker-2"]; ok || len(ans.VLANs[0].WorkerIPs) != 1 {
+		t.Errorf("input answers must not be modified")
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Режимы настройки OIDC в API server
+const (
+	oidcModeFlags      = "flags"
+	oidcModeStructured = "structured"
+)
+
+// oidcDir — каталог на control plane с файлами OIDC, монтируется в под API server
+const oidcDir = "/var/lib/oidc"
+
+// OIDCConfig — вход в кластер через OIDC-провайдер (Keycloak и т.п.)
+type OIDCConfig struct {
+	IssuerURL      string   `yaml:"issuerURL"`
+	ClientID       string   `yaml:"clientID"`
+	UsernameClaim  string   `yaml:"usernameClaim,omitempty"`
+	UsernamePrefix string   `yaml:"usernamePrefix,omitempty"`
+	GroupsClaim    string   `yaml:"groupsClaim,omitempty"`
+	GroupsPrefix   string   `yaml:"groupsPrefix,omitempty"`
+	CAFile         string   `yaml:"caFile,omitempty"`
+	Mode           string   `yaml:"mode,omitempty"`
+	ExtraScopes    []string `yaml:"extraScopes,omitempty"`
+}
+
+func (o *OIDCConfig) usernameClaim() string {
+	if o.UsernameClaim == "" {
+		return "email"
+	}
+	return o.UsernameClaim
+}
+
+func (o *OIDCConfig) structured() bool {
+	return o.Mode == oidcModeStructured
+}
+
+// authenticationConfig формирует AuthenticationConfiguration для режима structured.
+// v1 доступна с Kubernetes 1.34, до этого v1beta1.
+func (o *OIDCConfig) authenticationConfig(k8sVersion string, ca string) string {
+	apiVersion := "apiserver.config.k8s.io/v1beta1"
+	if isTalosVersionAtLeast(strings.TrimPrefix(k8sVersion, "v"), 1, 34) {
+		apiVersion = "apiserver.config.k8s.io/v1"
+	}
+	issuer := map[string]interface{}{
+		"url":       o.IssuerURL,
+		"audiences": []string{o.ClientID},
+	}
+	if ca != "" {
+		issuer["certificateAuthority"] = ca
+	}
+	claimMappings := map[string]interface{}{
+		"username": map[string]interface{}{"claim": o.usernameClaim(), "prefix": o.UsernamePrefix},
+	}
+	if o.GroupsClaim != "" {
+		claimMappings["groups"] = map[string]interface{}{"claim": o.GroupsClaim, "prefix": o.GroupsPrefix}
+	}
+	return yamlString(map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       "AuthenticationConfiguration",
+		"jwt":        []interface{}{map[string]interface{}{"issuer": issuer, "claimMappings": claimMappings}},
+	})
+}
+
+// applyOIDC добавляет в cluster.apiServer патча флаги OIDC или ссылку на файл AuthenticationConfiguration
+func applyOIDC(ans Answers, cluster map[string]interface{}) {
+	o := ans.OIDC
+	if o == nil {
+		return
+	}
+	args := componentArgs(cluster, "apiServer")
+	if o.structured() {
+		args["authentication-config"] = oidcDir + "/authentication-config.yaml"
+	} else {
+		args["oidc-issuer-url"] = o.IssuerURL
+		args["oidc-client-id"] = o.ClientID
+		args["oidc-username-claim"] = o.usernameClaim()
+		if o.UsernamePrefix != "" {
+			args["oidc-username-prefix"] = o.UsernamePrefix
+		}
+		if o.GroupsClaim != "" {
+			args["oidc-groups-claim"] = o.GroupsClaim
+		}
+		if o.GroupsPrefix != "" {
+			args["oidc-groups-prefix"] = o.GroupsPrefix
+		}
+		if o.CAFile != "" {
+			args["oidc-ca-file"] = oidcDir + "/ca.crt"
+		}
+	}
+	if o.structured() || o.CAFile != "" {
+		apiServer := nestedMap(cluster, "apiServer")
+		volumes, _ := apiServer["extraVolumes"].([]map[string]interface{})
+		apiServer["extraVolumes"] = append(volumes, map[string]interface{}{
+			"hostPath": oidcDir, "mountPath": oidcDir, "readonly": true,
+		})
+	}
+}
+
+// oidcFiles возвращает machine.files для control plane: CA провайдера и AuthenticationConfiguration
+func oidcFiles(ans Answers) ([]map[string]interface{}, error) {
+	o := ans.OIDC
+	if o == nil {
+		return nil, nil
+	}
+	var ca string
+	if o.CAFile != "" {
+		data, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("oidc.caFile: %v", err)
+		}
+		ca = string(data)
+	}
+	var files []map[string]interface{}
+	file := func(name, content string) {
+		files = append(files, map[string]interface{}{
+			"path":        oidcDir + "/" + name,
+			"content":     content,
+			"permissions": 0o644,
+			"op":          "create",
+		})
+	}
+	if o.structured() {
+		file("authentication-config.yaml", o.authenticationConfig(ans.K8sVersion, ca))
+	} else if ca != "" {
+		file("ca.crt", ca)
+	}
+	return files, nil
+}
+
+// applyOIDCFiles добавляет файлы OIDC в machine.files патча control plane
+func applyOIDCFiles(ans Answers, machine map[string]interface{}) error {
+	files, err := oidcFiles(ans)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	existing, _ := machine["files"].([]map[string]interface{})
+	machine["files"] = append(existing, files...)
+	return nil
+}
+
+// oidcExecArgs — аргументы kubectl oidc-login (kubelogin) для пользователя kubeconfig
+func oidcExecArgs(o *OIDCConfig) []string {
+	args := []string{"oidc-login", "get-token", "--oidc-issuer-url=" + o.IssuerURL, "--oidc-client-id=" + o.ClientID}
+	for _, scope := range o.ExtraScopes {
+		args = append(args, "--oidc-extra-scope="+scope)
+	}
+	if o.CAFile != "" {
+		if abs, err := filepath.Abs(o.CAFile); err == nil {
+			args = append(args, "--certificate-authority="+abs)
+		}
+	}
+	return args
+}
+
+// oidcUserName — имя пользователя и контекста OIDC в kubeconfig
+func oidcUserName(clusterName string) string {
+	return "oidc@" + clusterName
+}
+
+// addOIDCUser добавляет в экспортированный kubeconfig пользователя с exec-плагином kubelogin
+// и контекст для него на том же кластере, что и у admin
+func addOIDCUser(kubeconfigPath string, ans Answers) error {
+	docs, err := readYAMLDocs(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return fmt.Errorf("%s is empty", kubeconfigPath)
+	}
+	cfg := docs[0]
+	clusterRef := ans.ClusterName
+	if contexts, ok := cfg["contexts"].([]interface{}); ok && len(contexts) > 0 {
+		if ctx, ok := contexts[0].(map[string]interface{}); ok {
+			if c, ok := ctx["context"].(map[string]interface{}); ok {
+				if name, ok := c["cluster"].(string); ok {
+					clusterRef = name
+				}
+			}
+		}
+	}
+	name := oidcUserName(ans.ClusterName)
+	user := map[string]interface{}{
+		"name": name,
+		"user": map[string]interface{}{
+			"exec": map[string]interface{}{
+				"apiVersion":      "client.authentication.k8s.io/v1",
+				"command":         "kubectl",
+				"args":            oidcExecArgs(ans.OIDC),
+				"interactiveMode": "IfAvailable",
+			},
+		},
+	}
+	context := map[string]interface{}{
+		"name":    name,
+		"context": map[string]interface{}{"cluster": clusterRef, "user": name},
+	}
+	cfg["users"] = appendNamed(cfg["users"], user)
+	cfg["contexts"] = appendNamed(cfg["contexts"], context)
+	fileWriteYAMLDocs(kubeconfigPath, cfg)
+	return nil
+}
+
+// appendNamed добавляет элемент в список kubeconfig, заменяя элемент с тем же name
+func appendNamed(list interface{}, item map[string]interface{}) []interface{} {
+	items, _ := list.([]interface{})
+	for i, existing := range items {
+		if m, ok := existing.(map[string]interface{}); ok && m["name"] == item["name"] {
+			items[i] = item
+			return items
+		}
+	}
+	return append(items, item)
+}
+
+// oidcKubectlCommands — команды kubectl для ручного добавления пользователя OIDC в kubeconfig
+func oidcKubectlCommands(ans Answers) []string {
+	name := oidcUserName(ans.ClusterName)
+	kubeconfig := fmt.Sprintf("~/.kube/%s.yaml", ans.ClusterName)
+	cmd := fmt.Sprintf("kubectl config set-credentials %s --kubeconfig %s --exec-api-version=client.authentication.k8s.io/v1 --exec-interactive-mode=IfAvailable --exec-command=kubectl", name, kubeconfig)
+	for _, arg := range oidcExecArgs(ans.OIDC) {
+		cmd += " --exec-arg=" + arg
+	}
+	return []string{
+		cmd,
+		fmt.Sprintf("kubectl config set-context %s --kubeconfig %s --cluster %s --user %s", name, kubeconfig, ans.ClusterName, name),
+	}
+}
+
+// validateOIDC проверяет блок oidc: обязательные поля, режим и CA-файл
+func validateOIDC(ans Answers) error {
+	o := ans.OIDC
+	if o == nil {
+		return nil
+	}
+	if !strings.HasPrefix(o.IssuerURL, "https://") {
+		return fmt.Errorf("oidc.issuerURL must be an https:// URL")
+	}
+	if o.ClientID == "" {
+		return fmt.Errorf("oidc.clientID is required")
+	}
+	switch o.Mode {
+	case "", oidcModeFlags:
+	case oidcModeStructured:
+		if !isTalosVersionAtLeast(strings.TrimPrefix(ans.K8sVersion, "v"), 1, 30) {
+			return fmt.Errorf("oidc.mode: structured requires Kubernetes >= 1.30")
+		}
+	default:
+		return fmt.Errorf("oidc.mode: unknown value %q (expected flags or structured)", o.Mode)
+	}
+	if c := ans.ControlPlane; c != nil && c.APIServer != nil {
+		for k := range c.APIServer.ExtraArgs {
+			if strings.HasPrefix(k, "oidc-") || k == "authentication-config" {
+				return fmt.Errorf("controlPlane.apiServer.extraArgs: %s conflicts with the oidc block", k)
+			}
+		}
+	}
+	if _, err := oidcFiles(ans); err != nil {
+		return err
+	}
+	return nil
+}
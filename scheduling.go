@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Метки топологии Kubernetes
+const (
+	labelZone   = "topology.kubernetes.io/zone"
+	labelRegion = "topology.kubernetes.io/region"
+)
+
+var (
+	taintEffects = map[string]bool{"NoSchedule": true, "PreferNoSchedule": true, "NoExecute": true}
+	// имя метки: необязательный DNS-префикс и имя до 63 символов
+	labelNameRe  = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*/)?[A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?$`)
+	labelValueRe = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// nodeLabels собирает метки ноды: кластер, затем группа, затем нода (поздние перекрывают ранние).
+// zone и region ближайшего уровня пишутся в topology.kubernetes.io/*.
+func nodeLabels(ans Answers, hostname string) map[string]string {
+	labels := map[string]string{}
+	for k, v := range ans.Labels {
+		labels[k] = v
+	}
+	layers := nodeLayers(ans, hostname)
+	for i := len(layers) - 1; i >= 0; i-- {
+		for k, v := range layers[i].Labels {
+			labels[k] = v
+		}
+	}
+	zone, region := nodeTopology(ans, hostname)
+	if zone != "" {
+		labels[labelZone] = zone
+	}
+	if region != "" {
+		labels[labelRegion] = region
+	}
+	return labels
+}
+
+// nodeTaints собирает taints ноды так же, как метки. Значение — "value:Effect" или ":Effect".
+func nodeTaints(ans Answers, hostname string) map[string]string {
+	taints := map[string]string{}
+	for k, v := range ans.Taints {
+		taints[k] = v
+	}
+	layers := nodeLayers(ans, hostname)
+	for i := len(layers) - 1; i >= 0; i-- {
+		for k, v := range layers[i].Taints {
+			taints[k] = v
+		}
+	}
+	return taints
+}
+
+// nodeTopology возвращает зону и регион ноды (нода, группа или кластер)
+func nodeTopology(ans Answers, hostname string) (zone, region string) {
+	zone, region = ans.Zone, ans.Region
+	layers := nodeLayers(ans, hostname)
+	for i := len(layers) - 1; i >= 0; i-- {
+		if layers[i].Zone != "" {
+			zone = layers[i].Zone
+		}
+		if layers[i].Region != "" {
+			region = layers[i].Region
+		}
+	}
+	return zone, region
+}
+
+// applyNodeLabels добавляет machine.nodeLabels и machine.nodeTaints в патч ноды
+func applyNodeLabels(ans Answers, hostname string, machine map[string]interface{}) {
+	if labels := nodeLabels(ans, hostname); len(labels) > 0 {
+		machine["nodeLabels"] = labels
+	}
+	if taints := nodeTaints(ans, hostname); len(taints) > 0 {
+		machine["nodeTaints"] = taints
+	}
+}
+
+// validateLabels проверяет метки, taints и топологию на всех уровнях
+func validateLabels(ans Answers) error {
+	check := func(scope string, labels, taints map[string]string, zone, region string) error {
+		for k, v := range labels {
+			if !labelNameRe.MatchString(k) {
+				return fmt.Errorf("%slabels: invalid label name %q", scope, k)
+			}
+			if !labelValueRe.MatchString(v) {
+				return fmt.Errorf("%slabels: invalid value %q for %s", scope, v, k)
+			}
+			if (k == labelZone && zone != "") || (k == labelRegion && region != "") {
+				return fmt.Errorf("%slabels: %s conflicts with zone/region, use only one of them", scope, k)
+			}
+		}
+		for k, v := range taints {
+			if !labelNameRe.MatchString(k) {
+				return fmt.Errorf("%staints: invalid taint key %q", scope, k)
+			}
+			value, effect, ok := strings.Cut(v, ":")
+			if !ok || !taintEffects[effect] {
+				return fmt.Errorf("%staints: %s must be \"value:Effect\" or \":Effect\" (NoSchedule, PreferNoSchedule, NoExecute)", scope, k)
+			}
+			if !labelValueRe.MatchString(value) {
+				return fmt.Errorf("%staints: invalid value %q for %s", scope, value, k)
+			}
+		}
+		for _, v := range []string{zone, region} {
+			if !labelValueRe.MatchString(v) {
+				return fmt.Errorf("%sinvalid zone/region %q", scope, v)
+			}
+		}
+		return nil
+	}
+	if err := check("", ans.Labels, ans.Taints, ans.Zone, ans.Region); err != nil {
+		return err
+	}
+	for name, group := range ans.Groups {
+		if err := check(fmt.Sprintf("groups.%s.", name), group.Labels, group.Taints, group.Zone, group.Region); err != nil {
+			return err
+		}
+	}
+	for name, node := range ans.Nodes {
+		if err := check(fmt.Sprintf("nodes.%s.", name), node.Labels, node.Taints, node.Zone, node.Region); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Политики запуска нагрузки на control plane
+const (
+	schedulingAuto  = "auto"
+	schedulingAllow = "allow"
+	schedulingDeny  = "deny"
+)
+
+// cpSchedulingAllowed — разрешен ли запуск подов на control plane.
+// auto (по умолчанию): только если в кластере нет воркеров.
+func cpSchedulingAllowed(ans Answers) bool {
+	switch ans.ControlPlaneScheduling {
+	case schedulingAllow:
+		return true
+	case schedulingDeny:
+		return false
+	default:
+		return ans.WorkerCount == 0
+	}
+}
+
+// validateCPScheduling проверяет значение controlPlaneScheduling
+func validateCPScheduling(ans Answers) error {
+	switch ans.ControlPlaneScheduling {
+	case "", schedulingAuto, schedulingAllow:
+		return nil
+	case schedulingDeny:
+		if ans.WorkerCount == 0 {
+			return fmt.Errorf("controlPlaneScheduling: deny requires at least one worker, otherwise workloads cannot be scheduled")
+		}
+		return nil
+	default:
+		return fmt.Errorf("controlPlaneScheduling: unknown value %q (expected auto, allow or deny)", ans.ControlPlaneScheduling)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultFactoryURL        = "https://factory.talos.dev"
+	defaultSchematicPlatform = "nocloud"
+)
+
+// SchematicConfig описывает секцию schematic: в cluster.yaml
+type SchematicConfig struct {
+	Platform         string            `yaml:"platform,omitempty"`
+	TalosVersion     string            `yaml:"talosVersion,omitempty"`
+	SystemExtensions []string          `yaml:"systemExtensions,omitempty"`
+	ExtraKernelArgs  []string          `yaml:"extraKernelArgs,omitempty"`
+	Overlay          *SchematicOverlay `yaml:"overlay,omitempty"`
+	FactoryURL       string            `yaml:"factoryURL,omitempty"`
+}
+
+// SchematicOverlay описывает overlay для SBC (например, siderolabs/sbc-raspberrypi)
+type SchematicOverlay struct {
+	Image   string                 `yaml:"image"`
+	Name    string                 `yaml:"name"`
+	Options map[string]interface{} `yaml:"options,omitempty"`
+}
+
+// factorySchematic повторяет структуру schematic из Image Factory.
+// Порядок полей и теги важны: ID считается как sha256 от YAML этой структуры.
+type factorySchematic struct {
+	Overlay       factoryOverlay       `yaml:"overlay,omitempty"`
+	Customization factoryCustomization `yaml:"customization"`
+}
+
+type factoryOverlay struct {
+	Image   string                 `yaml:"image,omitempty"`
+	Name    string                 `yaml:"name,omitempty"`
+	Options map[string]interface{} `yaml:"options,omitempty"`
+}
+
+type factoryCustomization struct {
+	ExtraKernelArgs  []string                `yaml:"extraKernelArgs,omitempty"`
+	SystemExtensions factorySystemExtensions `yaml:"systemExtensions,omitempty"`
+}
+
+type factorySystemExtensions struct {
+	OfficialExtensions []string `yaml:"officialExtensions,omitempty"`
+}
+
+// moduleExtensions сопоставляет модули ядра с системными расширениями, которые их содержат
+var moduleExtensions = map[string]string{
+	"drbd":               "siderolabs/drbd",
+	"drbd_transport_tcp": "siderolabs/drbd",
+	"zfs":                "siderolabs/zfs",
+	"spl":                "siderolabs/zfs",
+}
+
+// toFactory приводит schematic к каноническому виду Image Factory:
+// расширения отсортированы и без дублей.
+func (s *SchematicConfig) toFactory() factorySchematic {
+	var fs factorySchematic
+	seen := map[string]struct{}{}
+	for _, ext := range s.SystemExtensions {
+		ext = strings.TrimSpace(ext)
+		if ext == "" {
+			continue
+		}
+		if _, ok := seen[ext]; ok {
+			continue
+		}
+		seen[ext] = struct{}{}
+		fs.Customization.SystemExtensions.OfficialExtensions = append(fs.Customization.SystemExtensions.OfficialExtensions, ext)
+	}
+	sort.Strings(fs.Customization.SystemExtensions.OfficialExtensions)
+	fs.Customization.ExtraKernelArgs = s.ExtraKernelArgs
+	if s.Overlay != nil {
+		fs.Overlay = factoryOverlay{
+			Image:   s.Overlay.Image,
+			Name:    s.Overlay.Name,
+			Options: s.Overlay.Options,
+		}
+	}
+	return fs
+}
+
+// Marshal возвращает YAML schematic в том виде, в котором его принимает и хеширует Image Factory
+func (s *SchematicConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(s.toFactory())
+}
+
+// ID вычисляет идентификатор schematic так же, как Image Factory (sha256 от канонического YAML)
+func (s *SchematicConfig) ID() (string, error) {
+	data, err := s.Marshal()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// platform возвращает платформу установщика (metal, nocloud, aws, ...)
+func (s *SchematicConfig) platform() string {
+	if s.Platform == "" {
+		return defaultSchematicPlatform
+	}
+	return s.Platform
+}
+
+// factoryURL возвращает базовый URL Image Factory без завершающего '/'
+func (s *SchematicConfig) factoryURL() string {
+	if s.FactoryURL == "" {
+		return defaultFactoryURL
+	}
+	return strings.TrimSuffix(s.FactoryURL, "/")
+}
+
+// schematicTalosVersion возвращает версию Talos для schematic с префиксом 'v'.
+// Если версия в schematic не задана, берется из образа.
+func schematicTalosVersion(s *SchematicConfig, fallbackImage string) string {
+	ver := s.TalosVersion
+	if ver == "" {
+		ver = extractTalosVersion(fallbackImage)
+	}
+	if ver == "" {
+		return ""
+	}
+	return "v" + strings.TrimPrefix(ver, "v")
+}
+
+// installerImage формирует ссылку на образ установщика для schematic.
+// Реестр совпадает с хостом Image Factory.
+// Пример: factory.talos.dev/nocloud-installer/<id>:v1.12.6
+func installerImage(factoryURL, platform, id, talosVersion string) string {
+	registry := strings.TrimPrefix(strings.TrimPrefix(factoryURL, "https://"), "http://")
+	return fmt.Sprintf("%s/%s-installer/%s:%s", registry, platform, id, talosVersion)
+}
+
+// missingModuleExtensions возвращает предупреждения для включенных модулей ядра,
+// для которых в schematic нет соответствующего расширения.
+func missingModuleExtensions(ans Answers) []string {
+	enabled := map[string]bool{
+		"drbd": ans.UseDRBD,
+		"zfs":  ans.UseZFS,
+		"spl":  ans.UseSPL,
+	}
+	exts := map[string]struct{}{}
+	for _, ext := range ans.Schematic.SystemExtensions {
+		exts[strings.TrimSpace(ext)] = struct{}{}
+	}
+	var warnings []string
+	for _, mod := range []string{"drbd", "zfs", "spl"} {
+		if !enabled[mod] {
+			continue
+		}
+		ext := moduleExtensions[mod]
+		if _, ok := exts[ext]; !ok {
+			warnings = append(warnings, fmt.Sprintf("kernel module %s is enabled, but extension %s is not in schematic.systemExtensions", mod, ext))
+		}
+	}
+	return warnings
+}
+
+// resolveSchematicTalosVersion определяет версию Talos для schematic:
+// schematic.talosVersion, затем image из cluster.yaml, затем --image
+func resolveSchematicTalosVersion(ans Answers) (string, error) {
+	talosVersion := schematicTalosVersion(ans.Schematic, ans.Image)
+	if talosVersion == "" {
+		talosVersion = schematicTalosVersion(ans.Schematic, image)
+	}
+	if talosVersion == "" {
+		return "", fmt.Errorf("cannot detect Talos version: set schematic.talosVersion")
+	}
+	return talosVersion, nil
+}
+
+// resolveSchematicImage вычисляет ID schematic и возвращает образ установщика для него
+func resolveSchematicImage(ans Answers) (string, error) {
+	id, err := ans.Schematic.ID()
+	if err != nil {
+		return "", err
+	}
+	talosVersion, err := resolveSchematicTalosVersion(ans)
+	if err != nil {
+		return "", err
+	}
+	for _, w := range missingModuleExtensions(ans) {
+		fmt.Printf("%s⚠️  %s%s\n", colorYellow, w, colorReset)
+	}
+	img := installerImage(ans.Schematic.factoryURL(), ans.Schematic.platform(), id, talosVersion)
+	if ans.Image != "" && ans.Image != img {
+		fmt.Printf("%s⚠️  image %s is replaced by schematic image%s\n", colorYellow, ans.Image, colorReset)
+	}
+	fmt.Printf("%sSchematic ID: %s%s\n", colorGreen, id, colorReset)
+	fmt.Printf("%sInstaller image: %s%s\n", colorGreen, img, colorReset)
+	return img, nil
+}
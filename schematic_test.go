@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+// emptySchematicID — ID пустого schematic в Image Factory
+const emptySchematicID = "376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba"
+
+func TestSchematicIDEmpty(t *testing.T) {
+	id, err := (&SchematicConfig{}).ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != emptySchematicID {
+		t.Errorf("empty schematic ID = %s, want %s", id, emptySchematicID)
+	}
+}
+
+func TestSchematicIDCanonicalExtensions(t *testing.T) {
+	canonical := &SchematicConfig{SystemExtensions: []string{"siderolabs/drbd", "siderolabs/iscsi-tools"}}
+	want, err := canonical.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, extensions := range [][]string{
+		{"siderolabs/iscsi-tools", "siderolabs/drbd"},
+		{"siderolabs/drbd", "siderolabs/iscsi-tools", "siderolabs/drbd"},
+		{" siderolabs/iscsi-tools", "", "siderolabs/drbd "},
+	} {
+		id, err := (&SchematicConfig{SystemExtensions: extensions}).ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want {
+			t.Errorf("ID(%q) = %s, want %s", extensions, id, want)
+		}
+	}
+	if id, _ := (&SchematicConfig{SystemExtensions: []string{"siderolabs/drbd"}}).ID(); id == want {
+		t.Errorf("different extensions must give a different ID")
+	}
+}
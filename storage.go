@@ -0,0 +1,521 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DiskSelector выбирает диск для установки по его свойствам (machine.install.diskSelector).
+// Имена устройств (/dev/sda, /dev/nvme0n1) меняются местами на серверах с несколькими дисками,
+// а свойства диска — нет.
+type DiskSelector struct {
+	Size    string `yaml:"size,omitempty"`
+	Model   string `yaml:"model,omitempty"`
+	Serial  string `yaml:"serial,omitempty"`
+	Type    string `yaml:"type,omitempty"`
+	WWID    string `yaml:"wwid,omitempty"`
+	BusPath string `yaml:"busPath,omitempty"`
+}
+
+var (
+	diskTypes = map[string]bool{"ssd": true, "hdd": true, "nvme": true, "sd": true}
+	// размер: "100GB", ">= 100GB", "<= 2TB"
+	diskSizeRe = regexp.MustCompile(`^(>=|<=|>|<|==)?\s*\d+(\.\d+)?\s*([KMGTP]i?B)?$`)
+	// размер тома: "100GB", "20GiB" или доля диска "50%"
+	volumeSizeRe = regexp.MustCompile(`^\d+(\.\d+)?\s*([KMGTP]i?B|%)?$`)
+)
+
+// installDiskPerNode проверяет, задан ли диск установки у какой-либо группы или ноды.
+// Тогда диск прописывается в патч каждой ноды, а не в общий patch.yaml.
+func installDiskPerNode(ans Answers) bool {
+	for _, group := range ans.Groups {
+		if group.Disk != "" || group.InstallDiskSelector != nil {
+			return true
+		}
+	}
+	for _, node := range ans.Nodes {
+		if node.Disk != "" || node.InstallDiskSelector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeInstallDisk возвращает блок machine.install с диском для ноды (нода, группа или кластер).
+// У diskSelector приоритет над disk в Talos, поэтому заполняется только одно из полей.
+func nodeInstallDisk(ans Answers, hostname string) map[string]interface{} {
+	for _, layer := range nodeLayers(ans, hostname) {
+		if layer.InstallDiskSelector != nil {
+			return map[string]interface{}{"diskSelector": layer.InstallDiskSelector}
+		}
+		if layer.Disk != "" {
+			return map[string]interface{}{"disk": layer.Disk}
+		}
+	}
+	return clusterInstallDisk(ans)
+}
+
+// clusterInstallDisk возвращает блок machine.install с диском уровня кластера
+func clusterInstallDisk(ans Answers) map[string]interface{} {
+	if ans.InstallDiskSelector != nil {
+		return map[string]interface{}{"diskSelector": ans.InstallDiskSelector}
+	}
+	return map[string]interface{}{"disk": ans.Disk}
+}
+
+// validateInstallDisk проверяет, что на каждом уровне задан либо disk, либо installDiskSelector
+func validateInstallDisk(ans Answers) error {
+	check := func(scope, disk string, selector *DiskSelector) error {
+		if selector == nil {
+			return nil
+		}
+		if disk != "" {
+			return fmt.Errorf("%sdisk and installDiskSelector are mutually exclusive", scope)
+		}
+		if *selector == (DiskSelector{}) {
+			return fmt.Errorf("%sinstallDiskSelector is empty", scope)
+		}
+		if selector.Type != "" && !diskTypes[selector.Type] {
+			return fmt.Errorf("%sinstallDiskSelector: unknown type %q (expected ssd, hdd, nvme or sd)", scope, selector.Type)
+		}
+		if selector.Size != "" && !diskSizeRe.MatchString(selector.Size) {
+			return fmt.Errorf("%sinstallDiskSelector: invalid size %q (e.g. \"100GB\", \">= 100GB\", \"<= 2TB\")", scope, selector.Size)
+		}
+		return nil
+	}
+	if err := check("", ans.Disk, ans.InstallDiskSelector); err != nil {
+		return err
+	}
+	for name, group := range ans.Groups {
+		if err := check(fmt.Sprintf("groups.%s.", name), group.Disk, group.InstallDiskSelector); err != nil {
+			return err
+		}
+	}
+	for name, node := range ans.Nodes {
+		if err := check(fmt.Sprintf("nodes.%s.", name), node.Disk, node.InstallDiskSelector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Системные тома Talos, которые можно зашифровать
+const (
+	volumeState     = "STATE"
+	volumeEphemeral = "EPHEMERAL"
+)
+
+// EncryptionConfig описывает шифрование системных томов STATE и EPHEMERAL
+type EncryptionConfig struct {
+	Volumes  []string        `yaml:"volumes,omitempty"`
+	Provider string          `yaml:"provider,omitempty"`
+	Cipher   string          `yaml:"cipher,omitempty"`
+	Keys     []EncryptionKey `yaml:"keys"`
+}
+
+// EncryptionKey — ключ LUKS2. Слоты назначаются по порядку ключей, задается ровно один тип.
+type EncryptionKey struct {
+	NodeID bool   `yaml:"nodeID,omitempty"`
+	Static string `yaml:"static,omitempty"`
+	TPM    bool   `yaml:"tpm,omitempty"`
+	KMS    string `yaml:"kms,omitempty"`
+}
+
+// nodeEncryption возвращает настройки шифрования для ноды (нода, группа или кластер)
+func nodeEncryption(ans Answers, hostname string) *EncryptionConfig {
+	for _, layer := range nodeLayers(ans, hostname) {
+		if layer.Encryption != nil {
+			return layer.Encryption
+		}
+	}
+	return ans.Encryption
+}
+
+func (e *EncryptionConfig) volumes() []string {
+	if len(e.Volumes) == 0 {
+		return []string{volumeState, volumeEphemeral}
+	}
+	return e.Volumes
+}
+
+// spec формирует блок encryption, одинаковый для VolumeConfig и machine.systemDiskEncryption
+func (e *EncryptionConfig) spec() map[string]interface{} {
+	provider := e.Provider
+	if provider == "" {
+		provider = "luks2"
+	}
+	var keys []map[string]interface{}
+	for slot, k := range e.Keys {
+		key := map[string]interface{}{"slot": slot}
+		switch {
+		case k.NodeID:
+			key["nodeID"] = map[string]interface{}{}
+		case k.Static != "":
+			key["static"] = map[string]interface{}{"passphrase": k.Static}
+		case k.TPM:
+			key["tpm"] = map[string]interface{}{}
+		case k.KMS != "":
+			key["kms"] = map[string]interface{}{"endpoint": k.KMS}
+		}
+		keys = append(keys, key)
+	}
+	spec := map[string]interface{}{"provider": provider, "keys": keys}
+	if e.Cipher != "" {
+		spec["cipher"] = e.Cipher
+	}
+	return spec
+}
+
+// volumeConfigDoc возвращает документ VolumeConfig с именем name, добавляя его в docs при отсутствии
+func volumeConfigDoc(docs []interface{}, name string) ([]interface{}, map[string]interface{}) {
+	for _, d := range docs {
+		doc, ok := d.(map[string]interface{})
+		if ok && doc["kind"] == "VolumeConfig" && doc["name"] == name {
+			return docs, doc
+		}
+	}
+	doc := map[string]interface{}{
+		"apiVersion": "v1alpha1",
+		"kind":       "VolumeConfig",
+		"name":       name,
+	}
+	return append(docs, doc), doc
+}
+
+// applyEncryption добавляет шифрование системных томов в патч ноды.
+// Talos >= 1.12: возвращает документы VolumeConfig для STATE/EPHEMERAL.
+// Talos < 1.12: заполняет machine.systemDiskEncryption в самом патче.
+func applyEncryption(ans Answers, hostname string, nodePatch map[string]interface{}, newFormat bool) []interface{} {
+	enc := nodeEncryption(ans, hostname)
+	if enc == nil {
+		return nil
+	}
+	if !newFormat {
+		legacy := map[string]interface{}{}
+		for _, vol := range enc.volumes() {
+			legacy[strings.ToLower(vol)] = enc.spec()
+		}
+		nodePatch["machine"].(map[string]interface{})["systemDiskEncryption"] = legacy
+		return nil
+	}
+	var docs []interface{}
+	for _, vol := range enc.volumes() {
+		docs = append(docs, map[string]interface{}{
+			"apiVersion": "v1alpha1",
+			"kind":       "VolumeConfig",
+			"name":       vol,
+			"encryption": enc.spec(),
+		})
+	}
+	return docs
+}
+
+// validateEncryption проверяет тома и ключи шифрования на всех уровнях
+func validateEncryption(ans Answers) error {
+	check := func(scope string, enc *EncryptionConfig) error {
+		if enc == nil {
+			return nil
+		}
+		for _, vol := range enc.Volumes {
+			if vol != volumeState && vol != volumeEphemeral {
+				return fmt.Errorf("%sencryption: unknown volume %q (expected %s or %s)", scope, vol, volumeState, volumeEphemeral)
+			}
+		}
+		if enc.Provider != "" && enc.Provider != "luks2" {
+			return fmt.Errorf("%sencryption: unsupported provider %q (only luks2)", scope, enc.Provider)
+		}
+		if len(enc.Keys) == 0 {
+			return fmt.Errorf("%sencryption: at least one key is required", scope)
+		}
+		for i, k := range enc.Keys {
+			set := 0
+			for _, ok := range []bool{k.NodeID, k.Static != "", k.TPM, k.KMS != ""} {
+				if ok {
+					set++
+				}
+			}
+			if set != 1 {
+				return fmt.Errorf("%sencryption.keys[%d]: set exactly one of nodeID, static, tpm, kms", scope, i)
+			}
+			if k.KMS != "" && !strings.HasPrefix(k.KMS, "https://") && !strings.HasPrefix(k.KMS, "http://") {
+				return fmt.Errorf("%sencryption.keys[%d]: kms endpoint must be an http(s) URL", scope, i)
+			}
+		}
+		return nil
+	}
+	if err := check("", ans.Encryption); err != nil {
+		return err
+	}
+	for name, group := range ans.Groups {
+		if err := check(fmt.Sprintf("groups.%s.", name), group.Encryption); err != nil {
+			return err
+		}
+	}
+	for name, node := range ans.Nodes {
+		if err := check(fmt.Sprintf("nodes.%s.", name), node.Encryption); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Файловые системы пользовательских томов
+var volumeFilesystems = map[string]bool{"xfs": true, "ext4": true}
+
+// volumeNameRe — имя тома Talos: используется в /var/mnt/<name>
+var volumeNameRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// VolumeSpec описывает дополнительный том на диске данных (local-path, LINSTOR и т.п.)
+type VolumeSpec struct {
+	Name string `yaml:"name"`
+	// Disk — путь к устройству; DiskSelector — CEL-выражение Talos (только для UserVolumeConfig)
+	Disk         string `yaml:"disk,omitempty"`
+	DiskSelector string `yaml:"diskSelector,omitempty"`
+	// Size — размер тома; если не задан, том занимает весь свободный диск
+	Size       string `yaml:"size,omitempty"`
+	Filesystem string `yaml:"filesystem,omitempty"`
+	Mountpoint string `yaml:"mountpoint,omitempty"`
+}
+
+// mountpoint возвращает точку монтирования тома (по умолчанию как у UserVolumeConfig)
+func (v VolumeSpec) mountpoint() string {
+	if v.Mountpoint == "" {
+		return "/var/mnt/" + v.Name
+	}
+	return v.Mountpoint
+}
+
+// nodeVolumes возвращает пользовательские тома ноды (нода или группа)
+func nodeVolumes(ans Answers, hostname string) []VolumeSpec {
+	for _, layer := range nodeLayers(ans, hostname) {
+		if len(layer.Volumes) > 0 {
+			return layer.Volumes
+		}
+	}
+	return nil
+}
+
+// applyUserVolumes добавляет пользовательские тома в патч ноды.
+// Talos >= 1.12: возвращает документы UserVolumeConfig (монтируются в /var/mnt/<name>).
+// Talos < 1.12: заполняет machine.disks разделами с точками монтирования.
+func applyUserVolumes(ans Answers, hostname string, nodePatch map[string]interface{}, newFormat bool) []interface{} {
+	volumes := nodeVolumes(ans, hostname)
+	if len(volumes) == 0 {
+		return nil
+	}
+	if !newFormat {
+		var disks []map[string]interface{}
+		byDevice := map[string]int{}
+		for _, v := range volumes {
+			partition := map[string]interface{}{"mountpoint": v.mountpoint()}
+			if v.Size != "" {
+				partition["size"] = v.Size
+			}
+			i, ok := byDevice[v.Disk]
+			if !ok {
+				i = len(disks)
+				byDevice[v.Disk] = i
+				disks = append(disks, map[string]interface{}{"device": v.Disk})
+			}
+			partitions, _ := disks[i]["partitions"].([]map[string]interface{})
+			disks[i]["partitions"] = append(partitions, partition)
+		}
+		nodePatch["machine"].(map[string]interface{})["disks"] = disks
+		return nil
+	}
+	var docs []interface{}
+	for _, v := range volumes {
+		match := v.DiskSelector
+		if match == "" {
+			match = fmt.Sprintf("disk.dev_path == '%s'", v.Disk)
+		}
+		provisioning := map[string]interface{}{
+			"diskSelector": map[string]interface{}{"match": match},
+		}
+		if v.Size != "" {
+			provisioning["minSize"] = v.Size
+			provisioning["maxSize"] = v.Size
+		} else {
+			provisioning["grow"] = true
+		}
+		doc := map[string]interface{}{
+			"apiVersion":   "v1alpha1",
+			"kind":         "UserVolumeConfig",
+			"name":         v.Name,
+			"provisioning": provisioning,
+		}
+		if v.Filesystem != "" {
+			doc["filesystem"] = map[string]interface{}{"type": v.Filesystem}
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// validateVolumes проверяет пользовательские тома групп и нод с учетом формата конфигурации Talos
+func validateVolumes(ans Answers, newFormat bool) error {
+	check := func(scope string, volumes []VolumeSpec) error {
+		names := map[string]bool{}
+		unsized := map[string]string{}
+		for i, v := range volumes {
+			prefix := fmt.Sprintf("%svolumes[%d]", scope, i)
+			if !volumeNameRe.MatchString(v.Name) {
+				return fmt.Errorf("%s: invalid name %q (lowercase letters, digits and '-')", prefix, v.Name)
+			}
+			if names[v.Name] {
+				return fmt.Errorf("%s: duplicate volume name %q", prefix, v.Name)
+			}
+			names[v.Name] = true
+			if v.Disk == "" && v.DiskSelector == "" {
+				return fmt.Errorf("%s: disk or diskSelector is required", prefix)
+			}
+			if v.Disk != "" && v.DiskSelector != "" {
+				return fmt.Errorf("%s: disk and diskSelector are mutually exclusive", prefix)
+			}
+			if v.Size != "" && !volumeSizeRe.MatchString(v.Size) {
+				return fmt.Errorf("%s: invalid size %q (e.g. \"100GB\")", prefix, v.Size)
+			}
+			if v.Filesystem != "" && !volumeFilesystems[v.Filesystem] {
+				return fmt.Errorf("%s: unsupported filesystem %q (expected xfs or ext4)", prefix, v.Filesystem)
+			}
+			if newFormat {
+				if v.Mountpoint != "" && v.Mountpoint != v.mountpoint() {
+					return fmt.Errorf("%s: UserVolumeConfig is always mounted at /var/mnt/%s, remove mountpoint", prefix, v.Name)
+				}
+				continue
+			}
+			// machine.disks: только путь к устройству, файловая система всегда xfs
+			// Talos знает UserVolumeConfig с 1.10, но talostpl пишет тома документами только с 1.12
+			if v.Disk == "" {
+				return fmt.Errorf("%s: diskSelector needs UserVolumeConfig documents, which talostpl emits for Talos >= 1.12; set disk instead", prefix)
+			}
+			if strings.HasSuffix(v.Size, "%") {
+				return fmt.Errorf("%s: machine.disks does not support percentage sizes on Talos < 1.12, use an absolute size (e.g. \"100GB\")", prefix)
+			}
+			if v.Filesystem != "" && v.Filesystem != "xfs" {
+				return fmt.Errorf("%s: machine.disks supports only xfs on Talos < 1.12", prefix)
+			}
+			// раздел без размера занимает остаток диска и должен быть последним
+			if prev, ok := unsized[v.Disk]; ok {
+				return fmt.Errorf("%s: volume %q on %s has no size and takes the rest of the disk, it must be the last one", prefix, prev, v.Disk)
+			}
+			if v.Size == "" {
+				unsized[v.Disk] = v.Name
+			}
+		}
+		return nil
+	}
+	for name, group := range ans.Groups {
+		if err := check(fmt.Sprintf("groups.%s.", name), group.Volumes); err != nil {
+			return err
+		}
+	}
+	for name, node := range ans.Nodes {
+		if err := check(fmt.Sprintf("nodes.%s.", name), node.Volumes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Том кеша образов Talos
+const volumeImageCache = "IMAGECACHE"
+
+// EphemeralConfig задает размер системного тома EPHEMERAL, чтобы на диске оставалось место под volumes
+type EphemeralConfig struct {
+	MinSize string `yaml:"minSize,omitempty"`
+	MaxSize string `yaml:"maxSize,omitempty"`
+	Grow    *bool  `yaml:"grow,omitempty"`
+}
+
+// ImageCacheConfig включает локальный кеш образов (machine.features.imageCache, том IMAGECACHE)
+type ImageCacheConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	MaxSize string `yaml:"maxSize,omitempty"`
+}
+
+// imageCacheSupported — кеш образов появился в Talos 1.10
+func imageCacheSupported(talosVersion string) bool {
+	return isTalosVersionAtLeast(talosVersion, 1, 10)
+}
+
+// nodeEphemeral возвращает настройки тома EPHEMERAL для ноды (нода, группа или кластер)
+func nodeEphemeral(ans Answers, hostname string) *EphemeralConfig {
+	for _, layer := range nodeLayers(ans, hostname) {
+		if layer.Ephemeral != nil {
+			return layer.Ephemeral
+		}
+	}
+	return ans.Ephemeral
+}
+
+// applyEphemeral добавляет размеры EPHEMERAL в документ VolumeConfig (общий с шифрованием, если оно задано)
+func applyEphemeral(ans Answers, hostname string, docs []interface{}) []interface{} {
+	eph := nodeEphemeral(ans, hostname)
+	if eph == nil {
+		return docs
+	}
+	provisioning := map[string]interface{}{}
+	if eph.MinSize != "" {
+		provisioning["minSize"] = eph.MinSize
+	}
+	if eph.MaxSize != "" {
+		provisioning["maxSize"] = eph.MaxSize
+	}
+	if eph.Grow != nil {
+		provisioning["grow"] = *eph.Grow
+	}
+	docs, doc := volumeConfigDoc(docs, volumeEphemeral)
+	doc["provisioning"] = provisioning
+	return docs
+}
+
+// applyImageCache ограничивает размер тома IMAGECACHE, если кеш включен и поддерживается версией Talos
+func applyImageCache(ans Answers, docs []interface{}, talosVersion string) []interface{} {
+	if ans.ImageCache == nil || !ans.ImageCache.Enabled || ans.ImageCache.MaxSize == "" || !imageCacheSupported(talosVersion) {
+		return docs
+	}
+	docs, doc := volumeConfigDoc(docs, volumeImageCache)
+	doc["provisioning"] = map[string]interface{}{"maxSize": ans.ImageCache.MaxSize}
+	return docs
+}
+
+// validateEphemeral проверяет размеры EPHEMERAL и кеша образов.
+// VolumeConfig для системных томов поддерживается начиная с Talos 1.8.
+func validateEphemeral(ans Answers, talosVersion string) error {
+	check := func(scope string, eph *EphemeralConfig) error {
+		if eph == nil {
+			return nil
+		}
+		if !isTalosVersionAtLeast(talosVersion, 1, 8) {
+			return fmt.Errorf("%sephemeral requires Talos >= 1.8", scope)
+		}
+		if *eph == (EphemeralConfig{}) {
+			return fmt.Errorf("%sephemeral is empty", scope)
+		}
+		for _, size := range []string{eph.MinSize, eph.MaxSize} {
+			if size != "" && !volumeSizeRe.MatchString(size) {
+				return fmt.Errorf("%sephemeral: invalid size %q (e.g. \"20GB\")", scope, size)
+			}
+		}
+		return nil
+	}
+	if err := check("", ans.Ephemeral); err != nil {
+		return err
+	}
+	for name, group := range ans.Groups {
+		if err := check(fmt.Sprintf("groups.%s.", name), group.Ephemeral); err != nil {
+			return err
+		}
+	}
+	for name, node := range ans.Nodes {
+		if err := check(fmt.Sprintf("nodes.%s.", name), node.Ephemeral); err != nil {
+			return err
+		}
+	}
+	if ans.ImageCache != nil && ans.ImageCache.MaxSize != "" && !volumeSizeRe.MatchString(ans.ImageCache.MaxSize) {
+		return fmt.Errorf("imageCache: invalid maxSize %q (e.g. \"10GB\")", ans.ImageCache.MaxSize)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateVolumesLegacy(t *testing.T) {
+	tests := []struct {
+		name    string
+		volume  VolumeSpec
+		wantErr string
+	}{
+		{"absolute size", VolumeSpec{Name: "data", Disk: "/dev/sdb", Size: "100GB"}, ""},
+		{"percentage size", VolumeSpec{Name: "data", Disk: "/dev/sdb", Size: "50%"}, "percentage sizes"},
+		{"disk selector", VolumeSpec{Name: "data", DiskSelector: "!disk.rotational"}, "Talos >= 1.12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ans := Answers{Nodes: map[string]NodeConfig{"worker-1": {Volumes: []VolumeSpec{tt.volume}}}}
+			err := validateVolumes(ans, false)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+	ans := Answers{Nodes: map[string]NodeConfig{"worker-1": {Volumes: []VolumeSpec{{Name: "data", Disk: "/dev/sdb", Size: "50%"}}}}}
+	if err := validateVolumes(ans, true); err != nil {
+		t.Errorf("UserVolumeConfig accepts percentage sizes, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// talosAPIManifestsFile — манифесты ServiceAccount Talos в каталоге конфигурации
+const talosAPIManifestsFile = "talos-serviceaccounts.yaml"
+
+// dnsLabelRe — имя namespace или ServiceAccount (DNS label)
+var dnsLabelRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// talosRoles — роли Talos API, которые можно выдать подам
+var talosRoles = map[string]bool{
+	"os:admin":        true,
+	"os:operator":     true,
+	"os:reader":       true,
+	"os:etcd:backup":  true,
+	"os:impersonator": true,
+}
+
+// TalosAPIAccessConfig — доступ подов к Talos API (machine.features.kubernetesTalosAPIAccess)
+type TalosAPIAccessConfig struct {
+	Roles           []string              `yaml:"roles,omitempty"`
+	Namespaces      []string              `yaml:"namespaces,omitempty"`
+	ServiceAccounts []TalosServiceAccount `yaml:"serviceAccounts,omitempty"`
+}
+
+// TalosServiceAccount — ресурс talos.dev/v1alpha1 ServiceAccount; Talos создает для него секрет с talosconfig
+type TalosServiceAccount struct {
+	Name      string   `yaml:"name"`
+	Namespace string   `yaml:"namespace,omitempty"`
+	Roles     []string `yaml:"roles"`
+}
+
+func (sa TalosServiceAccount) namespace() string {
+	if sa.Namespace == "" {
+		return "kube-system"
+	}
+	return sa.Namespace
+}
+
+// talosAPIAccess возвращает итоговые роли и namespaces: заданные явно и нужные ServiceAccount'ам.
+// Без namespaces доступ разрешается только из kube-system.
+// Talos CCM требует os:reader в kube-system.
+func talosAPIAccess(ans Answers) (roles, namespaces []string) {
+	a := ans.TalosAPIAccess
+	if a == nil {
+		a = &TalosAPIAccessConfig{}
+	}
+	roleSet, nsSet := map[string]bool{}, map[string]bool{}
+	// Talos CCM читает данные нод через Talos API из kube-system
+	if cloudProviderEnabled(ans) {
+		roleSet["os:reader"] = true
+		nsSet["kube-system"] = true
+	}
+	for _, r := range a.Roles {
+		roleSet[r] = true
+	}
+	for _, ns := range a.Namespaces {
+		nsSet[ns] = true
+	}
+	for _, sa := range a.ServiceAccounts {
+		for _, r := range sa.Roles {
+			roleSet[r] = true
+		}
+		nsSet[sa.namespace()] = true
+	}
+	for r := range roleSet {
+		roles = append(roles, r)
+	}
+	if len(nsSet) == 0 {
+		nsSet["kube-system"] = true
+	}
+	for ns := range nsSet {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(roles)
+	sort.Strings(namespaces)
+	return roles, namespaces
+}
+
+// applyTalosAPIAccess включает kubernetesTalosAPIAccess в патче control plane
+func applyTalosAPIAccess(ans Answers, machine map[string]interface{}) {
+	roles, namespaces := talosAPIAccess(ans)
+	if len(roles) == 0 {
+		return
+	}
+	access := nestedMap(machine, "features", "kubernetesTalosAPIAccess")
+	access["enabled"] = true
+	access["allowedRoles"] = roles
+	access["allowedKubernetesNamespaces"] = namespaces
+}
+
+// talosServiceAccountManifests формирует манифесты ServiceAccount для kubectl apply
+func talosServiceAccountManifests(ans Answers) []interface{} {
+	if ans.TalosAPIAccess == nil {
+		return nil
+	}
+	var docs []interface{}
+	for _, sa := range ans.TalosAPIAccess.ServiceAccounts {
+		docs = append(docs, map[string]interface{}{
+			"apiVersion": "talos.dev/v1alpha1",
+			"kind":       "ServiceAccount",
+			"metadata":   map[string]interface{}{"name": sa.Name, "namespace": sa.namespace()},
+			"spec":       map[string]interface{}{"roles": sa.Roles},
+		})
+	}
+	return docs
+}
+
+// validateTalosAPIAccess проверяет роли, namespaces и ServiceAccount'ы
+func validateTalosAPIAccess(ans Answers) error {
+	a := ans.TalosAPIAccess
+	if a == nil {
+		return nil
+	}
+	checkRoles := func(scope string, roles []string) error {
+		for _, r := range roles {
+			if !talosRoles[r] {
+				return fmt.Errorf("%s: unknown Talos role %q (expected os:admin, os:operator, os:reader, os:etcd:backup or os:impersonator)", scope, r)
+			}
+		}
+		return nil
+	}
+	if err := checkRoles("talosAPIAccess.roles", a.Roles); err != nil {
+		return err
+	}
+	for _, ns := range a.Namespaces {
+		if !dnsLabelRe.MatchString(ns) {
+			return fmt.Errorf("talosAPIAccess.namespaces: invalid namespace %q", ns)
+		}
+	}
+	seen := map[string]bool{}
+	for i, sa := range a.ServiceAccounts {
+		scope := fmt.Sprintf("talosAPIAccess.serviceAccounts[%d]", i)
+		if !dnsLabelRe.MatchString(sa.Name) {
+			return fmt.Errorf("%s: invalid name %q", scope, sa.Name)
+		}
+		if len(sa.Roles) == 0 {
+			return fmt.Errorf("%s: at least one role is required", scope)
+		}
+		if err := checkRoles(scope+".roles", sa.Roles); err != nil {
+			return err
+		}
+		if !dnsLabelRe.MatchString(sa.namespace()) {
+			return fmt.Errorf("%s: invalid namespace %q", scope, sa.Namespace)
+		}
+		key := sa.namespace() + "/" + sa.Name
+		if seen[key] {
+			return fmt.Errorf("%s: duplicate ServiceAccount %s", scope, key)
+		}
+		seen[key] = true
+	}
+	if roles, _ := talosAPIAccess(ans); len(roles) == 0 {
+		return fmt.Errorf("talosAPIAccess: set roles or serviceAccounts")
+	}
+	return nil
+}